@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+func aclSpec(args Args) kafka.AclSpec {
+	return kafka.AclSpec{
+		ResourceType: args.ResourceType,
+		ResourceName: args.ResourceName,
+		PatternType:  args.ResourcePattern,
+		Principal:    args.Principal,
+		Host:         args.AclHost,
+		Operation:    args.Operation,
+		Permission:   args.Permission,
+	}
+}
+
+func listAclsConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	filter, err := aclSpec(args).Filter()
+	if err != nil {
+		return usageErrorf("invalid ACL filter: %v", err)
+	}
+	acls, err := kafka.ListAcls(admin, filter)
+	if err != nil {
+		return fmt.Errorf("could not list ACLs: %w", err)
+	}
+	printResult(log, args, func() string { return CreateAclTable(acls) }, acls)
+	return nil
+}
+
+func createAclConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	acl, err := kafka.CreateAcl(admin, aclSpec(args))
+	if err != nil {
+		return fmt.Errorf("could not create ACL: %w", err)
+	}
+	log.Infof("ACL created")
+	printResult(log, args, func() string { return CreateAclTable([]kafka.AclInfo{acl}) }, acl)
+	return nil
+}
+
+func deleteAclConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	filter, err := aclSpec(args).Filter()
+	if err != nil {
+		return usageErrorf("invalid ACL filter: %v", err)
+	}
+
+	// Show what would be deleted before doing anything since a broad filter can match a lot of ACLs
+	acls, err := kafka.ListAcls(admin, filter)
+	if err != nil {
+		return fmt.Errorf("could not list ACLs: %w", err)
+	}
+	if len(acls) == 0 {
+		log.Infof("could not find any ACLs matching the filter")
+		return nil
+	}
+	log.Infof("the following %d ACL(s) match the filter\n%s", len(acls), CreateAclTable(acls))
+	if args.DryRun {
+		return nil
+	}
+	if err = confirm(args, "delete these ACLs"); err != nil {
+		return err
+	}
+
+	deleted, err := kafka.DeleteAcls(admin, filter)
+	if err != nil {
+		return fmt.Errorf("could not delete ACLs: %w", err)
+	}
+	log.Infof("%d ACL(s) deleted", len(deleted))
+	return nil
+}
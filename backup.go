@@ -0,0 +1,406 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+/*
+ * A backup is a gzipped tar archive with the topic metadata in topic.json followed by one partitions/<n>.ndjson entry
+ * per partition. Every line of a partition entry is a message in the same JSON format as the dumps of storeMessages,
+ * i.e. with its key, headers, timestamp and original offset.
+ */
+const (
+	backupMetadataEntry  = "topic.json"
+	backupPartitionsDir  = "partitions"
+	backupReadBatchSize  = 1000
+	restoreSendBatchSize = 500
+)
+
+// BackupMetadata describes the backed up topic
+type BackupMetadata struct {
+	Topic             string            `json:"topic"`
+	Created           time.Time         `json:"created"`
+	Partitions        int32             `json:"partitions"`
+	ReplicationFactor int16             `json:"replicationFactor"`
+	Configs           map[string]string `json:"configs"`
+	Records           int               `json:"records"`
+	PartitionInfo     []BackupPartition `json:"partitionInfo"`
+}
+
+// BackupPartition holds the offsets of a partition when the backup was taken and the number of records backed up
+type BackupPartition struct {
+	Partition     int32 `json:"partition"`
+	OldestOffset  int64 `json:"oldestOffset"`
+	HighWaterMark int64 `json:"highWaterMark"`
+	Records       int   `json:"records"`
+	// StoppedAt is the offset reading stopped at - below the high water mark if the partition was not backed up completely
+	StoppedAt int64 `json:"stoppedAt"`
+}
+
+func (p BackupPartition) complete() bool {
+	return p.StoppedAt >= p.HighWaterMark
+}
+
+// RestorePartition maps the original offsets of a partition to the offsets the records got when restored
+type RestorePartition struct {
+	Partition           int32
+	Records             int
+	FirstOffset         int64
+	LastOffset          int64
+	RestoredFirstOffset int64
+	RestoredLastOffset  int64
+}
+
+// RestoreSummary is the result of a restoreTopic run
+type RestoreSummary struct {
+	Topic      string
+	Created    bool
+	DryRun     bool
+	Records    int
+	Partitions []RestorePartition
+}
+
+func backupPartitionEntry(partition int32) string {
+	return path.Join(backupPartitionsDir, fmt.Sprintf("%d.ndjson", partition))
+}
+
+func backupTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) error {
+	fileName, err := valueOrDialogue(args, args.File, "--file", "Enter a file name to use", "X")
+	if err != nil {
+		return err
+	}
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
+	metadata, err := backupTopic(log, fileName, topicName, admin, client)
+	if err != nil {
+		return fmt.Errorf("could not back up topic %s: %w", topicName, err)
+	}
+	printResult(log, args, func() string { return CreateBackupTable(metadata) }, metadata)
+	incomplete := []string{}
+	for _, p := range metadata.PartitionInfo {
+		if !p.complete() {
+			incomplete = append(incomplete, fmt.Sprintf("partition %d stopped at offset %d of high water mark %d", p.Partition, p.StoppedAt, p.HighWaterMark))
+		}
+	}
+	if len(incomplete) > 0 {
+		return fmt.Errorf("backup of topic %s in file %s is incomplete: %s", topicName, fileName, strings.Join(incomplete, ", "))
+	}
+	log.Infof("Backed up %d messages of topic %s to file: %s", metadata.Records, topicName, fileName)
+	return nil
+}
+
+func backupTopic(log common.Logger, fileName string, topicName string, admin sarama.ClusterAdmin, client sarama.Client) (BackupMetadata, error) {
+	metadata := BackupMetadata{Topic: topicName, Created: time.Now(), PartitionInfo: []BackupPartition{}}
+	settings, err := kafka.DescribeTopicSettings(admin, topicName)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Partitions = settings.Partitions
+	metadata.ReplicationFactor = settings.ReplicationFactor
+	metadata.Configs = settings.Configs
+
+	reader, err := kafka.NewPartitionReader(client, topicName)
+	if err != nil {
+		return metadata, err
+	}
+	defer reader.Close()
+	partitions, err := reader.Partitions()
+	if err != nil {
+		return metadata, err
+	}
+
+	// tar needs the size of an entry up front so every partition is read into a temporary file first
+	tempFiles := []*os.File{}
+	defer func() {
+		for _, f := range tempFiles {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for _, p := range partitions {
+		f, err := os.CreateTemp("", fmt.Sprintf("jokk-backup-%d-*.ndjson", p))
+		if err != nil {
+			return metadata, err
+		}
+		tempFiles = append(tempFiles, f)
+		info, err := backupPartition(log, reader, p, f)
+		if err != nil {
+			return metadata, fmt.Errorf("could not read partition %d: %w", p, err)
+		}
+		metadata.PartitionInfo = append(metadata.PartitionInfo, info)
+		metadata.Records += info.Records
+	}
+
+	out, err := os.Create(fileName)
+	if err != nil {
+		return metadata, fmt.Errorf("could not create file %s: %w", fileName, err)
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return metadata, err
+	}
+	if err = writeTarEntry(tw, backupMetadataEntry, int64(len(b)), strings.NewReader(string(b))); err != nil {
+		return metadata, err
+	}
+	for i, f := range tempFiles {
+		size, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return metadata, err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return metadata, err
+		}
+		if err = writeTarEntry(tw, backupPartitionEntry(partitions[i]), size, f); err != nil {
+			return metadata, err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return metadata, err
+	}
+	if err = gz.Close(); err != nil {
+		return metadata, err
+	}
+	return metadata, out.Close()
+}
+
+// backupPartition writes the records of a partition up to the high water mark at the time of the call
+func backupPartition(log common.Logger, reader *kafka.PartitionReader, partition int32, w io.Writer) (BackupPartition, error) {
+	oldest, highWaterMark, err := reader.OffsetRange(partition)
+	info := BackupPartition{Partition: partition, OldestOffset: oldest, HighWaterMark: highWaterMark, StoppedAt: oldest}
+	if err != nil {
+		return info, err
+	}
+
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	offset, err := reader.ReadRange(partition, oldest, highWaterMark, backupReadBatchSize, func(msg *sarama.ConsumerMessage) error {
+		info.Records++
+		return encoder.Encode(msg)
+	})
+	if err != nil {
+		return info, err
+	}
+	info.StoppedAt = offset
+	if info.complete() {
+		log.Infof("Backed up %d messages of partition %d (offsets %d - %d)", info.Records, partition, oldest, highWaterMark)
+	} else {
+		log.Warnf("Backed up %d messages of partition %d but stopped at offset %d of high water mark %d - no messages arrived after %d reads", info.Records, partition, offset, highWaterMark, kafka.ReadRetries)
+	}
+	return info, bw.Flush()
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+func restoreTopicConsole(log common.Logger, admin sarama.ClusterAdmin, brokers []string, config *sarama.Config, args Args) error {
+	fileName, err := valueOrDialogue(args, args.File, "--file", "Enter the backup file to restore", "X")
+	if err != nil {
+		return err
+	}
+	summary, err := restoreTopic(log, fileName, admin, brokers, config, args)
+	if err != nil {
+		return fmt.Errorf("could not restore topic from file %s: %w", fileName, err)
+	}
+	printResult(log, args, func() string { return CreateRestoreTable(summary) }, summary)
+	if args.DryRun {
+		log.Infof("Dry run: %d messages would be restored to topic %s", summary.Records, summary.Topic)
+	} else {
+		log.Infof("Restored %d messages to topic %s", summary.Records, summary.Topic)
+	}
+	return nil
+}
+
+// restoreTopic creates the topic if it does not exist and produces every record to its original partition in order
+func restoreTopic(log common.Logger, fileName string, admin sarama.ClusterAdmin, brokers []string, config *sarama.Config, args Args) (RestoreSummary, error) {
+	summary := RestoreSummary{DryRun: args.DryRun, Partitions: []RestorePartition{}}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return summary, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return summary, fmt.Errorf("not a backup file: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != backupMetadataEntry {
+		return summary, fmt.Errorf("not a backup file: %s is missing", backupMetadataEntry)
+	}
+	metadata := BackupMetadata{}
+	if err = json.NewDecoder(tr).Decode(&metadata); err != nil {
+		return summary, fmt.Errorf("invalid %s: %w", backupMetadataEntry, err)
+	}
+
+	summary.Topic = metadata.Topic
+	if args.Topic != "" {
+		summary.Topic = args.Topic
+	}
+	if summary.Created, err = prepareRestoreTopic(log, summary.Topic, metadata, admin, args); err != nil {
+		return summary, err
+	}
+
+	var producer sarama.SyncProducer
+	if !args.DryRun {
+		// Every record goes to the partition it was backed up from and one request at a time keeps them in order
+		restoreConfig := *config
+		restoreConfig.Producer.Partitioner = sarama.NewManualPartitioner
+		restoreConfig.Producer.Return.Successes = true
+		restoreConfig.Net.MaxOpenRequests = 1
+		producer, err = kafka.NewProducer(brokers, &restoreConfig)
+		if err != nil {
+			return summary, err
+		}
+		defer kafka.CloseProducer(log, producer)
+	}
+
+	for {
+		header, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return summary, err
+		}
+		partition, ok := strings.CutSuffix(strings.TrimPrefix(header.Name, backupPartitionsDir+"/"), ".ndjson")
+		p, err := strconv.ParseInt(partition, 10, 32)
+		if !ok || err != nil {
+			log.Warnf("Skipping unknown entry %s in backup", header.Name)
+			continue
+		}
+		result, err := restorePartition(summary.Topic, int32(p), tr, producer)
+		if err != nil {
+			return summary, fmt.Errorf("could not restore partition %d: %w", p, err)
+		}
+		summary.Records += result.Records
+		summary.Partitions = append(summary.Partitions, result)
+	}
+	return summary, nil
+}
+
+// prepareRestoreTopic creates the topic with the backed up settings or, if it exists, checks that the records fit
+func prepareRestoreTopic(log common.Logger, topicName string, metadata BackupMetadata, admin sarama.ClusterAdmin, args Args) (bool, error) {
+	settings, err := kafka.DescribeTopicSettings(admin, topicName)
+	if err == nil {
+		if settings.Partitions < metadata.Partitions {
+			return false, usageErrorf("topic %s has %d partitions but the backup has %d (use extendPartitions first)", topicName, settings.Partitions, metadata.Partitions)
+		}
+		if args.DryRun {
+			return false, nil
+		}
+		return false, confirm(args, fmt.Sprintf("Topic %s exists - append %d messages to it", topicName, metadata.Records))
+	}
+
+	replicationFactor := metadata.ReplicationFactor
+	if args.ReplicationFactor > 0 {
+		replicationFactor = args.ReplicationFactor
+	}
+	if args.DryRun {
+		log.Infof("Dry run: topic %s would be created with %d partitions, replication factor %d and configs %v", topicName, metadata.Partitions, replicationFactor, metadata.Configs)
+		return true, nil
+	}
+	configs := map[string]*string{}
+	for name, value := range metadata.Configs {
+		configs[name] = &value
+	}
+	err = admin.CreateTopic(topicName, &sarama.TopicDetail{
+		NumPartitions:     metadata.Partitions,
+		ReplicationFactor: replicationFactor,
+		ReplicaAssignment: map[int32][]int32{},
+		ConfigEntries:     configs,
+	}, false)
+	if err != nil {
+		return false, fmt.Errorf("could not create topic %s: %w", topicName, err)
+	}
+	log.Infof("Topic %s created with %d partitions and replication factor %d", topicName, metadata.Partitions, replicationFactor)
+	return true, nil
+}
+
+func restorePartition(topicName string, partition int32, r io.Reader, producer sarama.SyncProducer) (RestorePartition, error) {
+	result := RestorePartition{Partition: partition, FirstOffset: -1, LastOffset: -1, RestoredFirstOffset: -1, RestoredLastOffset: -1}
+	batch := []*sarama.ProducerMessage{}
+	send := func() error {
+		if producer == nil || len(batch) == 0 {
+			batch = batch[:0]
+			return nil
+		}
+		if err := producer.SendMessages(batch); err != nil {
+			return err
+		}
+		if result.RestoredFirstOffset < 0 {
+			result.RestoredFirstOffset = batch[0].Offset
+		}
+		result.RestoredLastOffset = batch[len(batch)-1].Offset
+		batch = batch[:0]
+		return nil
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		msg := sarama.ConsumerMessage{}
+		if err := decoder.Decode(&msg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return result, err
+		}
+		pMsg := &sarama.ProducerMessage{
+			Topic:     topicName,
+			Partition: partition,
+			Timestamp: msg.Timestamp,
+			Headers:   []sarama.RecordHeader{},
+		}
+		// keep nil keys and values (e.g. tombstones) nil
+		if msg.Key != nil {
+			pMsg.Key = sarama.ByteEncoder(msg.Key)
+		}
+		if msg.Value != nil {
+			pMsg.Value = sarama.ByteEncoder(msg.Value)
+		}
+		for _, h := range msg.Headers {
+			if h != nil {
+				pMsg.Headers = append(pMsg.Headers, *h)
+			}
+		}
+		if result.FirstOffset < 0 {
+			result.FirstOffset = msg.Offset
+		}
+		result.LastOffset = msg.Offset
+		result.Records++
+
+		batch = append(batch, pMsg)
+		if len(batch) >= restoreSendBatchSize {
+			if err := send(); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, send()
+}
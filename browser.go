@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+const (
+	browserPageSize = 100
+	// the number of pages kept in memory - older pages are read from Kafka again when needed
+	browserCachedPages = 20
+)
+
+// ringBuffer keeps the last items that were added and overwrites the oldest one when it is full
+type ringBuffer[T any] struct {
+	items []T
+	next  int
+	size  int
+}
+
+func newRingBuffer[T any](capacity int) *ringBuffer[T] {
+	return &ringBuffer[T]{items: make([]T, capacity)}
+}
+
+func (r *ringBuffer[T]) add(item T) {
+	r.items[r.next] = item
+	r.next = (r.next + 1) % len(r.items)
+	if r.size < len(r.items) {
+		r.size++
+	}
+}
+
+// find returns the most recently added item that matches
+func (r *ringBuffer[T]) find(matches func(T) bool) (T, bool) {
+	for i := 1; i <= r.size; i++ {
+		item := r.items[(r.next-i+len(r.items))%len(r.items)]
+		if matches(item) {
+			return item, true
+		}
+	}
+	var empty T
+	return empty, false
+}
+
+func (r *ringBuffer[T]) clear() {
+	var empty T
+	for i := range r.items {
+		r.items[i] = empty
+	}
+	r.next = 0
+	r.size = 0
+}
+
+type messagePage struct {
+	partition int32
+	offset    int64
+	messages  []sarama.ConsumerMessage
+}
+
+/*
+ * The messageBrowser pages through the messages of a topic one partition at a time. Every partition keeps its own
+ * position so it is possible to switch between partitions and continue where you left off.
+ */
+type messageBrowser struct {
+	mutex      sync.Mutex
+	reader     *kafka.PartitionReader
+	partitions []int32
+	partition  int
+	offsets    map[int32]int64
+	pageSize   int
+	pages      *ringBuffer[messagePage]
+}
+
+// newMessageBrowser starts every partition at the start time if one is given and at the oldest message otherwise
+func newMessageBrowser(client sarama.Client, topic string, startTime time.Time) (*messageBrowser, error) {
+	reader, err := kafka.NewPartitionReader(client, topic)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := reader.Partitions()
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	b := &messageBrowser{
+		reader:     reader,
+		partitions: partitions,
+		offsets:    map[int32]int64{},
+		pageSize:   browserPageSize,
+		pages:      newRingBuffer[messagePage](browserCachedPages),
+	}
+	for _, p := range partitions {
+		if startTime.IsZero() {
+			b.offsets[p] = sarama.OffsetOldest
+		} else if b.offsets[p], err = reader.OffsetForTime(p, startTime); err != nil {
+			reader.Close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *messageBrowser) currentPartition() int32 {
+	return b.partitions[b.partition]
+}
+
+// page returns the current page of the current partition
+func (b *messageBrowser) page() (messagePage, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.currentPage()
+}
+
+func (b *messageBrowser) currentPage() (messagePage, error) {
+	partition := b.currentPartition()
+	offset := b.offsets[partition]
+	if page, ok := b.pages.find(func(p messagePage) bool { return p.partition == partition && p.offset == offset && p.messages != nil }); ok {
+		return page, nil
+	}
+	messages, err := b.reader.Read(partition, offset, b.pageSize)
+	if err != nil {
+		return messagePage{}, err
+	}
+	page := messagePage{partition: partition, offset: offset, messages: messages}
+	b.pages.add(page)
+	return page, nil
+}
+
+// moveTo sets the offset of the current page of the current partition
+func (b *messageBrowser) moveTo(offset func(oldest int64, newest int64, page messagePage) int64) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	partition := b.currentPartition()
+	oldest, newest, err := b.reader.OffsetRange(partition)
+	if err != nil {
+		return err
+	}
+	page, err := b.currentPage()
+	if err != nil {
+		return err
+	}
+	o := offset(oldest, newest, page)
+	if o < oldest {
+		o = oldest
+	}
+	b.offsets[partition] = o
+	return nil
+}
+
+func (b *messageBrowser) nextPage() error {
+	return b.moveTo(func(oldest int64, newest int64, page messagePage) int64 {
+		if len(page.messages) == 0 {
+			return page.offset
+		}
+		next := page.messages[len(page.messages)-1].Offset + 1
+		if next >= newest {
+			return page.offset
+		}
+		return next
+	})
+}
+
+func (b *messageBrowser) previousPage() error {
+	return b.moveTo(func(oldest int64, newest int64, page messagePage) int64 {
+		start := page.offset
+		if len(page.messages) > 0 {
+			start = page.messages[0].Offset
+		}
+		return start - int64(b.pageSize)
+	})
+}
+
+func (b *messageBrowser) firstPage() error {
+	return b.moveTo(func(oldest int64, newest int64, page messagePage) int64 {
+		return oldest
+	})
+}
+
+func (b *messageBrowser) lastPage() error {
+	return b.moveTo(func(oldest int64, newest int64, page messagePage) int64 {
+		return newest - int64(b.pageSize)
+	})
+}
+
+func (b *messageBrowser) jumpToOffset(offset int64) error {
+	return b.moveTo(func(oldest int64, newest int64, page messagePage) int64 {
+		if offset >= newest {
+			return newest - int64(b.pageSize)
+		}
+		return offset
+	})
+}
+
+func (b *messageBrowser) jumpToTime(t time.Time) error {
+	b.mutex.Lock()
+	offset, err := b.reader.OffsetForTime(b.currentPartition(), t)
+	b.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return b.jumpToOffset(offset)
+}
+
+// switchPartition moves to the next (1) or previous (-1) partition
+func (b *messageBrowser) switchPartition(direction int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.partition = (b.partition + direction + len(b.partitions)) % len(b.partitions)
+}
+
+// refresh drops the cached pages so that new messages show up
+func (b *messageBrowser) refresh() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.pages.clear()
+}
+
+// position describes where in the topic the current page is
+func (b *messageBrowser) position(page messagePage) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	oldest, newest, err := b.reader.OffsetRange(page.partition)
+	if err != nil {
+		return fmt.Sprintf("partition %d (%d of %d)", page.partition, b.partition+1, len(b.partitions))
+	}
+	if len(page.messages) == 0 {
+		return fmt.Sprintf("partition %d (%d of %d), no messages at offset %d, offsets [%d - %d]", page.partition, b.partition+1, len(b.partitions), page.offset, oldest, newest)
+	}
+	return fmt.Sprintf("partition %d (%d of %d), offsets %d - %d of [%d - %d]", page.partition, b.partition+1, len(b.partitions),
+		page.messages[0].Offset, page.messages[len(page.messages)-1].Offset, oldest, newest)
+}
+
+func (b *messageBrowser) close() {
+	b.reader.Close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+)
+
+// TopicOperationResult is the outcome of an operation on a single topic
+type TopicOperationResult struct {
+	Topic   string
+	Success bool
+	Error   string
+}
+
+// runOnTopics applies the operation to every topic using a bounded pool of workers
+func runOnTopics(topics []string, workers int, operation func(topic string) error) []TopicOperationResult {
+	if workers < 1 {
+		workers = 1
+	}
+	topicChan := make(chan string)
+	resultChan := make(chan TopicOperationResult, len(topics))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range topicChan {
+				result := TopicOperationResult{Topic: t, Success: true}
+				if err := operation(t); err != nil {
+					result.Success = false
+					result.Error = err.Error()
+				}
+				resultChan <- result
+			}
+		}()
+	}
+	for _, t := range topics {
+		topicChan <- t
+	}
+	close(topicChan)
+	wg.Wait()
+	close(resultChan)
+
+	results := []TopicOperationResult{}
+	for r := range resultChan {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Topic < results[j].Topic
+	})
+	return results
+}
+
+/*
+ * Runs an operation on the topic picked with --topic/-f or, with --all-matching, on every topic matching the filter.
+ * Bulk operations always list the affected topics and ask for confirmation (unless --yes is given) before running
+ * concurrently, and end with a summary of the result per topic.
+ */
+func topicOperationConsole(log common.Logger, admin sarama.ClusterAdmin, args Args, action string, destructive bool, operation func(topic string) error) error {
+	if !args.AllMatching {
+		topicName, _, err := pickTopic(log, admin, args)
+		if err != nil {
+			return err
+		}
+		if destructive {
+			if err = confirm(args, fmt.Sprintf("%s topic %s", action, topicName)); err != nil {
+				return err
+			}
+		}
+		return operation(topicName)
+	}
+
+	if args.Filter == "" && args.Topic == "" {
+		return usageErrorf("--all-matching requires -f/--filter to select the topics")
+	}
+	topicNames, err := matchingTopics(admin, args)
+	if err != nil {
+		return err
+	}
+	log.Infof("the following %d topic(s) match the filter: %s\n%s", len(topicNames), args.Filter, strings.Join(topicNames, "\n"))
+	if args.DryRun {
+		log.Infof("Dry run: no topics changed")
+		return nil
+	}
+	if err = confirm(args, fmt.Sprintf("%s %d topic(s)", action, len(topicNames))); err != nil {
+		return err
+	}
+
+	results := runOnTopics(topicNames, args.Workers, operation)
+	printResult(log, args, func() string { return CreateTopicOperationTable(results) }, results)
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not %s %d of %d topic(s)", action, failed, len(results))
+	}
+	log.Infof("%d topic(s) done", len(results))
+	return nil
+}
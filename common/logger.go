@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -58,8 +59,12 @@ func (l DevNullLogger) Clear() {}
 // CONSOLE LOGGER
 
 func NewConsoleLogger() ConsoleLogger {
+	return NewConsoleLoggerWithWriter(os.Stdout)
+}
+
+func NewConsoleLoggerWithWriter(out io.Writer) ConsoleLogger {
 	return ConsoleLogger{
-		logger: zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}).With().Timestamp().Logger(),
+		logger: zerolog.New(zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}).With().Timestamp().Logger(),
 	}
 }
 
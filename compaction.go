@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+// PartitionCompaction is what compactionReport found in one partition
+type PartitionCompaction struct {
+	Partition    int32
+	Records      int
+	DistinctKeys int
+	// DuplicateKeyRecords are the records whose key occurs again at a later offset - what compaction removes
+	DuplicateKeyRecords int
+	Tombstones          int
+	OldestTombstone     *time.Time `json:",omitempty" yaml:",omitempty"`
+	Bytes               int64
+	ObsoleteBytes       int64
+	DirtyRatio          float64
+	// Partial is set when the partition could not be scanned up to its high water mark - the numbers only cover the records before StoppedAt
+	Partial   bool
+	StoppedAt int64 `json:",omitempty" yaml:",omitempty"`
+}
+
+// CompactionReport is the result of compactionReport
+type CompactionReport struct {
+	Topic                  string
+	CleanupPolicy          string
+	MinCleanableDirtyRatio float64
+	DeleteRetentionMs      int64
+	Records                int
+	DistinctKeys           int
+	DuplicateKeyRecords    int
+	Tombstones             int
+	OldestTombstone        *time.Time `json:",omitempty" yaml:",omitempty"`
+	Bytes                  int64
+	ObsoleteBytes          int64
+	DirtyRatio             float64
+	// Partial is set when at least one partition could not be scanned completely
+	Partial    bool
+	Partitions []PartitionCompaction
+}
+
+// recordSize estimates the size of a record from its key, value and headers
+func recordSize(msg *sarama.ConsumerMessage) int64 {
+	size := len(msg.Key) + len(msg.Value)
+	for _, h := range msg.Headers {
+		if h != nil {
+			size += len(h.Key) + len(h.Value)
+		}
+	}
+	return int64(size)
+}
+
+// ratio returns part/total, 0 for an empty total
+func ratio(part int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+func compactPartition(reader *kafka.PartitionReader, partition int32) (PartitionCompaction, error) {
+	result := PartitionCompaction{Partition: partition}
+	// the size of the latest record of every key - a newer record makes the previous one obsolete
+	latest := map[string]int64{}
+	err := scanPartition(reader, partition, func(msg *sarama.ConsumerMessage) {
+		size := recordSize(msg)
+		result.Records++
+		result.Bytes += size
+		if msg.Value == nil {
+			result.Tombstones++
+			if result.OldestTombstone == nil || msg.Timestamp.Before(*result.OldestTombstone) {
+				timestamp := msg.Timestamp
+				result.OldestTombstone = &timestamp
+			}
+		}
+		key := string(msg.Key)
+		if previous, ok := latest[key]; ok {
+			result.DuplicateKeyRecords++
+			result.ObsoleteBytes += previous
+		}
+		latest[key] = size
+	})
+	result.DistinctKeys = len(latest)
+	result.DirtyRatio = ratio(result.ObsoleteBytes, result.Bytes)
+	// a partition that stops early still tells something about the topic, so it is reported as partial
+	var incomplete *incompleteScanError
+	if errors.As(err, &incomplete) {
+		result.Partial = true
+		result.StoppedAt = incomplete.offset
+		err = nil
+	}
+	return result, err
+}
+
+func compactionReport(admin sarama.ClusterAdmin, client sarama.Client, topicName string) (CompactionReport, error) {
+	report := CompactionReport{Topic: topicName}
+	policy, err := kafka.TopicConfigValue(admin, topicName, "cleanup.policy")
+	if err != nil {
+		return report, err
+	}
+	if !strings.Contains(policy, "compact") {
+		return report, usageErrorf("topic %s is not compacted (cleanup.policy=%s)", topicName, policy)
+	}
+	report.CleanupPolicy = policy
+	if value, err := kafka.TopicConfigValue(admin, topicName, "min.cleanable.dirty.ratio"); err == nil {
+		report.MinCleanableDirtyRatio, _ = strconv.ParseFloat(value, 64)
+	}
+	if value, err := kafka.TopicConfigValue(admin, topicName, "delete.retention.ms"); err == nil {
+		report.DeleteRetentionMs, _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	reader, err := kafka.NewPartitionReader(client, topicName)
+	if err != nil {
+		return report, err
+	}
+	defer reader.Close()
+	partitions, err := reader.Partitions()
+	if err != nil {
+		return report, err
+	}
+	for _, p := range partitions {
+		result, err := compactPartition(reader, p)
+		if err != nil {
+			return report, fmt.Errorf("could not scan partition %d: %w", p, err)
+		}
+		report.Partitions = append(report.Partitions, result)
+		report.Records += result.Records
+		report.DistinctKeys += result.DistinctKeys
+		report.DuplicateKeyRecords += result.DuplicateKeyRecords
+		report.Tombstones += result.Tombstones
+		report.Bytes += result.Bytes
+		report.ObsoleteBytes += result.ObsoleteBytes
+		report.Partial = report.Partial || result.Partial
+		if result.OldestTombstone != nil && (report.OldestTombstone == nil || result.OldestTombstone.Before(*report.OldestTombstone)) {
+			report.OldestTombstone = result.OldestTombstone
+		}
+	}
+	report.DirtyRatio = ratio(report.ObsoleteBytes, report.Bytes)
+	return report, nil
+}
+
+// compactionFindings explains the report - why the cleaner does or does not compact the topic
+func compactionFindings(report CompactionReport) []string {
+	findings := []string{
+		fmt.Sprintf("%d records, %d distinct keys, %d duplicate key records and %d tombstones", report.Records, report.DistinctKeys, report.DuplicateKeyRecords, report.Tombstones),
+	}
+	if report.OldestTombstone != nil {
+		age := time.Since(*report.OldestTombstone).Round(time.Second)
+		retention := time.Duration(report.DeleteRetentionMs) * time.Millisecond
+		finding := fmt.Sprintf("The oldest tombstone is %v old (delete.retention.ms: %v)", age, retention)
+		if report.DeleteRetentionMs > 0 && age > retention {
+			finding += " - it should have been removed, the cleaner has not compacted the segment holding it"
+		}
+		findings = append(findings, finding)
+	}
+	eligible := 0
+	for _, p := range report.Partitions {
+		if p.ObsoleteBytes > 0 && p.DirtyRatio >= report.MinCleanableDirtyRatio {
+			eligible++
+		}
+	}
+	finding := fmt.Sprintf("Estimated dirty ratio %.2f (min.cleanable.dirty.ratio: %.2f)", report.DirtyRatio, report.MinCleanableDirtyRatio)
+	if eligible == 0 {
+		finding += " - no partition is above the minimum, so the cleaner leaves the topic as it is"
+	} else {
+		finding += fmt.Sprintf(" - %d of %d partitions are above the minimum and eligible for cleaning (except for their active segment)", eligible, len(report.Partitions))
+	}
+	findings = append(findings, finding)
+	for _, p := range report.Partitions {
+		if p.Partial {
+			findings = append(findings, fmt.Sprintf("Partition %d could only be read up to offset %d, so the estimate is partial (marked with *)", p.Partition, p.StoppedAt))
+		}
+	}
+	return findings
+}
+
+func compactionReportConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) error {
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
+	report, err := compactionReport(admin, client, topicName)
+	if err != nil {
+		return fmt.Errorf("could not create compaction report of topic %s: %w", topicName, err)
+	}
+
+	printResult(log, args, func() string { return CreateCompactionTable(report) }, report)
+	for _, finding := range compactionFindings(report) {
+		log.Info(finding)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/henrikengstrom/jokk/schemaregistry"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Decoder turns the raw bytes of a message key or value into text - structured formats are decoded to JSON
+type Decoder interface {
+	Decode(data []byte) (string, error)
+}
+
+// Func makes it possible to use an ordinary function as a Decoder
+type Func func(data []byte) (string, error)
+
+func (f Func) Decode(data []byte) (string, error) {
+	return f(data)
+}
+
+// Options holds the settings that some of the decoders need
+type Options struct {
+	Registry          *schemaregistry.Client
+	AvroSchemaFile    string
+	DescriptorSetFile string
+	ProtoPath         string
+	MessageType       string
+}
+
+// Factory creates a decoder for a format
+type Factory func(options Options) (Decoder, error)
+
+var (
+	mutex     sync.Mutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a decoder available under the format name, replacing any decoder with the same name
+func Register(format string, factory Factory) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	factories[strings.ToLower(format)] = factory
+}
+
+// Formats returns the names of all registered formats
+func Formats() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	formats := []string{}
+	for f := range factories {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// New creates the decoder registered for the format
+func New(format string, options Options) (Decoder, error) {
+	mutex.Lock()
+	factory, ok := factories[strings.ToLower(format)]
+	mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s - available formats: %s", format, strings.Join(Formats(), ", "))
+	}
+	return factory(options)
+}
+
+// Lazy creates the decoder when it is first used so that a broken schema only affects the messages it is used for
+func Lazy(format string, options Options) Decoder {
+	var (
+		once    sync.Once
+		decoder Decoder
+		err     error
+	)
+	return Func(func(data []byte) (string, error) {
+		once.Do(func() {
+			decoder, err = New(format, options)
+		})
+		if err != nil {
+			return "", err
+		}
+		return decoder.Decode(data)
+	})
+}
+
+func simple(f Func) Factory {
+	return func(options Options) (Decoder, error) {
+		return f, nil
+	}
+}
+
+func init() {
+	Register("auto", auto)
+	Register("string", simple(decodeString))
+	Register("hex", simple(decodeHex))
+	Register("base64", simple(decodeBase64))
+	Register("json", simple(decodeJson))
+	Register("msgpack", simple(decodeMsgpack))
+	Register("int64", simple(decodeInt64))
+	Register("uuid", simple(decodeUuid))
+	Register("registry", registry)
+	Register("avro", avro)
+	Register("protobuf", protobuf)
+}
+
+/*
+ * The auto format uses the schema registry for payloads with the schema registry header (if a registry is configured),
+ * shows text as it is and falls back to hex for binary data that would otherwise mess up the output.
+ */
+func auto(options Options) (Decoder, error) {
+	return Func(func(data []byte) (string, error) {
+		if options.Registry != nil && schemaregistry.IsFramed(data) {
+			decoded, err := options.Registry.Decode(data)
+			if err == nil {
+				return string(decoded), nil
+			}
+		}
+		if utf8.Valid(data) && isPrintable(string(data)) {
+			return string(data), nil
+		}
+		return decodeHex(data)
+	}), nil
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r < 32 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func registry(options Options) (Decoder, error) {
+	if options.Registry == nil {
+		return nil, fmt.Errorf("the registry format requires a schema registry (schema_registry_url in jokk.toml)")
+	}
+	return Func(func(data []byte) (string, error) {
+		decoded, err := options.Registry.Decode(data)
+		return string(decoded), err
+	}), nil
+}
+
+func decodeString(data []byte) (string, error) {
+	return string(data), nil
+}
+
+func decodeHex(data []byte) (string, error) {
+	return hex.EncodeToString(data), nil
+}
+
+func decodeBase64(data []byte) (string, error) {
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func decodeJson(data []byte) (string, error) {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	return compacted.String(), nil
+}
+
+func decodeMsgpack(data []byte) (string, error) {
+	var value any
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return "", fmt.Errorf("invalid msgpack: %v", err)
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+// decodeInt64 expects a big-endian number, e.g. written by Kafka's LongSerializer
+func decodeInt64(data []byte) (string, error) {
+	if len(data) != 8 {
+		return "", fmt.Errorf("expected 8 bytes for an int64 but got %d", len(data))
+	}
+	return strconv.FormatInt(int64(binary.BigEndian.Uint64(data)), 10), nil
+}
+
+// decodeUuid accepts both the 16 byte binary and the 36 character text representation of a UUID
+func decodeUuid(data []byte) (string, error) {
+	if len(data) == 36 {
+		return string(data), nil
+	}
+	if len(data) != 16 {
+		return "", fmt.Errorf("expected 16 bytes for a UUID but got %d", len(data))
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:16]), nil
+}
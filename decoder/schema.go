@@ -0,0 +1,166 @@
+package decoder
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/henrikengstrom/jokk/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// avro decodes plain Avro binary with a schema file - payloads with the schema registry header use the registry instead
+func avro(options Options) (Decoder, error) {
+	var codec *goavro.Codec
+	if options.AvroSchemaFile != "" {
+		schema, err := os.ReadFile(options.AvroSchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		if codec, err = goavro.NewCodec(string(schema)); err != nil {
+			return nil, fmt.Errorf("invalid avro schema %s: %v", options.AvroSchemaFile, err)
+		}
+	} else if options.Registry == nil {
+		return nil, fmt.Errorf("the avro format requires an avro schema file (--avro-schema) or a schema registry")
+	}
+
+	return Func(func(data []byte) (string, error) {
+		if options.Registry != nil && schemaregistry.IsFramed(data) {
+			decoded, err := options.Registry.Decode(data)
+			return string(decoded), err
+		}
+		if codec == nil {
+			return "", fmt.Errorf("payload does not have a schema registry header and no avro schema file is given")
+		}
+		native, _, err := codec.NativeFromBinary(data)
+		if err != nil {
+			return "", fmt.Errorf("invalid avro: %v", err)
+		}
+		decoded, err := codec.TextualFromNative(nil, native)
+		return string(decoded), err
+	}), nil
+}
+
+// LoadMessageDescriptor finds a message type in a descriptor set file (e.g. created with 'protoc --include_imports -o')
+func LoadMessageDescriptor(descriptorSetFile string, messageType string) (protoreflect.MessageDescriptor, error) {
+	b, err := os.ReadFile(descriptorSetFile)
+	if err != nil {
+		return nil, err
+	}
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(b, descriptorSet); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %v", descriptorSetFile, err)
+	}
+	files, err := protodesc.NewFiles(descriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %v", descriptorSetFile, err)
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find message type %s in %s: %v", messageType, descriptorSetFile, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", messageType)
+	}
+	return messageDescriptor, nil
+}
+
+// LoadProtoMessage compiles the .proto files in a directory (used as import path) and finds a message type in them
+func LoadProtoMessage(protoPath string, messageType string) (protoreflect.MessageDescriptor, error) {
+	fileNames := []string{}
+	err := filepath.WalkDir(protoPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(p) == ".proto" {
+			rel, err := filepath.Rel(protoPath, p)
+			if err != nil {
+				return err
+			}
+			fileNames = append(fileNames, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read proto path %s: %v", protoPath, err)
+	}
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no .proto files found in %s", protoPath)
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{protoPath}}),
+	}
+	files, err := compiler.Compile(context.Background(), fileNames...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile .proto files in %s: %v", protoPath, err)
+	}
+	descriptor, err := files.AsResolver().FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find message type %s in %s: %v", messageType, protoPath, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", messageType)
+	}
+	return messageDescriptor, nil
+}
+
+// ProtobufMessage decodes data as the message type to JSON
+func ProtobufMessage(descriptor protoreflect.MessageDescriptor, data []byte) (string, error) {
+	// a protobuf message cannot start with a zero byte so this is the schema registry header
+	if schemaregistry.IsFramed(data) {
+		_, payload, err := schemaregistry.Unframe(data)
+		if err != nil {
+			return "", err
+		}
+		if _, data, err = schemaregistry.MessageIndexes(payload); err != nil {
+			return "", err
+		}
+	}
+	msg := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return "", fmt.Errorf("invalid protobuf %s: %v", descriptor.FullName(), err)
+	}
+	b, err := protojson.Marshal(msg)
+	return string(b), err
+}
+
+// protobuf decodes with a message type from a descriptor set file, a directory of .proto files or with the schema registry
+func protobuf(options Options) (Decoder, error) {
+	var descriptor protoreflect.MessageDescriptor
+	if options.DescriptorSetFile != "" || options.ProtoPath != "" {
+		if options.MessageType == "" {
+			return nil, fmt.Errorf("the protobuf format requires a message type (--proto-message) with a descriptor set or proto path")
+		}
+		var err error
+		if options.DescriptorSetFile != "" {
+			descriptor, err = LoadMessageDescriptor(options.DescriptorSetFile, options.MessageType)
+		} else {
+			descriptor, err = LoadProtoMessage(options.ProtoPath, options.MessageType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if options.Registry == nil {
+		return nil, fmt.Errorf("the protobuf format requires a descriptor set file (--proto-descriptor-set), a proto path (--proto-path) or a schema registry")
+	}
+
+	return Func(func(data []byte) (string, error) {
+		if descriptor == nil {
+			decoded, err := options.Registry.Decode(data)
+			return string(decoded), err
+		}
+		return ProtobufMessage(descriptor, data)
+	}), nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+// ReplayJournalEntry is written (one JSON document per line) to the journal file for every replayed message
+type ReplayJournalEntry struct {
+	Topic      string    `json:"topic"`
+	Partition  int32     `json:"partition"`
+	Offset     int64     `json:"offset"`
+	Target     string    `json:"target"`
+	ReplayedAt time.Time `json:"replayedAt"`
+}
+
+type replayJournal struct {
+	fileName string
+	replayed map[string]bool
+}
+
+// ReplaySummary is the result of a replayDLQ run
+type ReplaySummary struct {
+	Topic           string
+	DryRun          bool
+	Replayed        int
+	AlreadyReplayed int
+	FilteredOut     int
+	NoTarget        int
+}
+
+func journalKey(topic string, partition int32, offset int64) string {
+	return fmt.Sprintf("%s/%d/%d", topic, partition, offset)
+}
+
+func loadReplayJournal(fileName string) (*replayJournal, error) {
+	journal := &replayJournal{
+		fileName: fileName,
+		replayed: make(map[string]bool),
+	}
+
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return journal, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry ReplayJournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt journal entry in %s: %v", fileName, err)
+		}
+		journal.replayed[journalKey(entry.Topic, entry.Partition, entry.Offset)] = true
+	}
+
+	return journal, scanner.Err()
+}
+
+func (j *replayJournal) contains(msg sarama.ConsumerMessage) bool {
+	return j.replayed[journalKey(msg.Topic, msg.Partition, msg.Offset)]
+}
+
+func (j *replayJournal) record(msg sarama.ConsumerMessage, target string) error {
+	f, err := os.OpenFile(j.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(ReplayJournalEntry{
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Target:     target,
+		ReplayedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(string(b) + "\n"); err != nil {
+		return err
+	}
+
+	j.replayed[journalKey(msg.Topic, msg.Partition, msg.Offset)] = true
+	return nil
+}
+
+// replayTarget determines what topic a dead-lettered message should be produced to
+func replayTarget(msg sarama.ConsumerMessage, args Args) string {
+	if args.ReplayTopic != "" {
+		return args.ReplayTopic
+	}
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == args.ReplayTopicHeader {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// replayHeaders copies the headers of a message except the ones starting with any of the strip prefixes
+func replayHeaders(msg sarama.ConsumerMessage, stripPrefixes []string) []sarama.RecordHeader {
+	headers := []sarama.RecordHeader{}
+Loop:
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		for _, prefix := range stripPrefixes {
+			if strings.HasPrefix(string(h.Key), prefix) {
+				continue Loop
+			}
+		}
+		headers = append(headers, *h)
+	}
+	return headers
+}
+
+func replayDLQConsole(log common.Logger, admin sarama.ClusterAdmin, consumer kafka.JokkConsumer, decoders messageDecoders, brokers []string, config *sarama.Config, args Args) error {
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
+	summary, err := replayDLQ(log, topicName, consumer, decoders, brokers, config, args)
+	if err != nil {
+		return fmt.Errorf("could not replay messages from topic %s: %w", topicName, err)
+	}
+
+	if !tableOutput(args) {
+		if err = writeOutput(os.Stdout, args.Output, summary); err != nil {
+			return fmt.Errorf("could not write %s output: %w", args.Output, err)
+		}
+	} else if args.DryRun {
+		log.Infof("Dry run: %d messages would be replayed, %d already replayed, %d filtered out, %d without target topic", summary.Replayed, summary.AlreadyReplayed, summary.FilteredOut, summary.NoTarget)
+	} else {
+		log.Infof("Replayed %d messages, %d already replayed, %d filtered out, %d without target topic", summary.Replayed, summary.AlreadyReplayed, summary.FilteredOut, summary.NoTarget)
+	}
+	return nil
+}
+
+func replayDLQ(log common.Logger, topicName string, consumer kafka.JokkConsumer, decoders messageDecoders, brokers []string, config *sarama.Config, args Args) (ReplaySummary, error) {
+	summary := ReplaySummary{Topic: topicName, DryRun: args.DryRun}
+	headerFilters, err := parseHeaderFilters(args.HeaderFilter)
+	if err != nil {
+		return summary, err
+	}
+	start, end, err := parseTime(log, args.StartTime, args.EndTime)
+	if err != nil {
+		return summary, err
+	}
+	journal, err := loadReplayJournal(args.JournalFile)
+	if err != nil {
+		return summary, err
+	}
+
+	var producer sarama.SyncProducer
+	if !args.DryRun {
+		// Keyed messages should end up in the same partition as when they were originally produced
+		replayConfig := *config
+		replayConfig.Producer.Partitioner = sarama.NewHashPartitioner
+		producer, err = kafka.NewProducer(brokers, &replayConfig)
+		if err != nil {
+			return summary, err
+		}
+		defer kafka.CloseProducer(log, producer)
+	}
+
+	consumer.StartReceivingMessages(topicName)
+	msgTicker := time.NewTicker(3 * time.Second)
+	log.Infof("Replaying messages from dead-letter topic %s (journal: %s)", topicName, args.JournalFile)
+Loop:
+	for {
+		select {
+		case <-msgTicker.C:
+			log.Infof("Did not find any (additional) message - exiting")
+			break Loop
+		case msg := <-consumer.MsgChannel:
+			msgTicker.Reset(1 * time.Second)
+			if !start.Before(msg.Timestamp) || !end.After(msg.Timestamp) {
+				continue
+			}
+			if journal.contains(msg) {
+				summary.AlreadyReplayed++
+				continue
+			}
+			if !messageMatches(decoders, msg, headerFilters, args.ValueMatch) {
+				summary.FilteredOut++
+				continue
+			}
+			target := replayTarget(msg, args)
+			if target == "" {
+				log.Warnf("No target topic found for message at partition %d offset %d - skipping", msg.Partition, msg.Offset)
+				summary.NoTarget++
+				continue
+			}
+
+			pMsg := sarama.ProducerMessage{
+				Topic:   target,
+				Headers: replayHeaders(msg, args.StripHeaders),
+			}
+			if msg.Key != nil {
+				pMsg.Key = sarama.ByteEncoder(msg.Key)
+			}
+			if msg.Value != nil {
+				pMsg.Value = sarama.ByteEncoder(msg.Value)
+			}
+
+			if args.DryRun {
+				log.Infof("[Partition : Offset -> Target] %d : %d -> %s, key: %s, headers: %d, value: %s", msg.Partition, msg.Offset, target, string(msg.Key), len(pMsg.Headers), string(msg.Value))
+			} else {
+				if _, _, err = producer.SendMessage(&pMsg); err != nil {
+					return summary, err
+				}
+				if err = journal.record(msg, target); err != nil {
+					return summary, fmt.Errorf("message at partition %d offset %d was replayed but could not be journaled: %v", msg.Partition, msg.Offset, err)
+				}
+			}
+			summary.Replayed++
+		}
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	manifestSuffix   = ".manifest.json"
+	checkpointSuffix = ".checkpoint.json"
+	// how often the checkpoint of a running dump is updated
+	checkpointInterval = 5 * time.Second
+)
+
+// resumableFormats are the record formats a dump can be continued in after the last checkpoint (see --resume)
+var resumableFormats = map[string]bool{
+	"json":   true,
+	"ndjson": true,
+	"csv":    true,
+	"raw":    true,
+}
+
+/*
+ * The dumpManifest describes a dump that is compressed and/or split into chunks (--compress, --max-file-size and
+ * --max-records-per-file). It is written next to the chunks and can be given to importMessages to replay them in order.
+ */
+type dumpManifest struct {
+	Topic          string              `json:"topic"`
+	RecordFormat   string              `json:"recordFormat"`
+	Compression    string              `json:"compression,omitempty"`
+	Created        time.Time           `json:"created"`
+	Records        int                 `json:"records"`
+	FirstTimestamp *time.Time          `json:"firstTimestamp,omitempty"`
+	LastTimestamp  *time.Time          `json:"lastTimestamp,omitempty"`
+	Partitions     []manifestPartition `json:"partitions"`
+	Files          []manifestFile      `json:"files"`
+}
+
+type manifestPartition struct {
+	Partition   int32 `json:"partition"`
+	FirstOffset int64 `json:"firstOffset"`
+	LastOffset  int64 `json:"lastOffset"`
+	Records     int   `json:"records"`
+}
+
+type manifestFile struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func (m *dumpManifest) add(msg sarama.ConsumerMessage) {
+	m.Records++
+	if m.FirstTimestamp == nil || msg.Timestamp.Before(*m.FirstTimestamp) {
+		t := msg.Timestamp
+		m.FirstTimestamp = &t
+	}
+	if m.LastTimestamp == nil || msg.Timestamp.After(*m.LastTimestamp) {
+		t := msg.Timestamp
+		m.LastTimestamp = &t
+	}
+	for i := range m.Partitions {
+		p := &m.Partitions[i]
+		if p.Partition == msg.Partition {
+			p.FirstOffset = min(p.FirstOffset, msg.Offset)
+			p.LastOffset = max(p.LastOffset, msg.Offset)
+			p.Records++
+			return
+		}
+	}
+	m.Partitions = append(m.Partitions, manifestPartition{Partition: msg.Partition, FirstOffset: msg.Offset, LastOffset: msg.Offset, Records: 1})
+	sort.Slice(m.Partitions, func(i, j int) bool { return m.Partitions[i].Partition < m.Partitions[j].Partition })
+}
+
+/*
+ * The dumpCheckpoint is written next to a dump while it is being written. It holds the state of the dump at the last
+ * point where everything written so far was complete on disk, so that an interrupted storeMessages can continue from
+ * there with --resume: the last file of the manifest is truncated to its Bytes and appended to.
+ */
+type dumpCheckpoint struct {
+	Updated time.Time `json:"updated"`
+	// Offsets holds the last consumed offset of every partition (including messages that were filtered out)
+	Offsets  map[int32]int64 `json:"offsets"`
+	Manifest dumpManifest    `json:"manifest"`
+}
+
+func loadCheckpoint(fileName string) (dumpCheckpoint, error) {
+	checkpoint := dumpCheckpoint{}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return checkpoint, err
+	}
+	if err = json.Unmarshal(b, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("invalid checkpoint %s: %w", fileName, err)
+	}
+	if len(checkpoint.Manifest.Files) == 0 {
+		return checkpoint, fmt.Errorf("invalid checkpoint %s: no files", fileName)
+	}
+	return checkpoint, nil
+}
+
+func loadManifest(fileName string) (dumpManifest, error) {
+	manifest := dumpManifest{}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return manifest, err
+	}
+	if err = json.Unmarshal(b, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest %s: %w", fileName, err)
+	}
+	return manifest, nil
+}
+
+// parseSize parses sizes like '500000', '512KB', '100MB' or '2GB' (1KB = 1024 bytes)
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB"} {
+		if strings.HasSuffix(s, unit) {
+			multiplier = 1 << (10 * (i + 1))
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(s), "B"), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return n * multiplier, nil
+}
+
+var compressionExtensions = map[string]string{
+	"gzip":   ".gz",
+	"zstd":   ".zst",
+	"snappy": ".sz",
+}
+
+func compressor(compression string, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "snappy":
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+func decompressor(compression string, r io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case "snappy":
+		return io.NopCloser(snappy.NewReader(r)), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+/*
+ * The streamCompressor writes a compressed file as a series of streams (gzip members, zstd frames or snappy streams)
+ * that are read back as one. Close ends the current stream and the next write starts a new one, which makes it
+ * possible to continue a compressed file after its last complete stream.
+ */
+type streamCompressor struct {
+	compression string
+	w           io.Writer
+	stream      io.WriteCloser
+}
+
+func newStreamCompressor(compression string, w io.Writer) (*streamCompressor, error) {
+	s := &streamCompressor{compression: compression, w: w}
+	stream, err := compressor(compression, w)
+	s.stream = stream
+	return s, err
+}
+
+func (s *streamCompressor) Write(p []byte) (int, error) {
+	if s.stream == nil {
+		stream, err := compressor(s.compression, s.w)
+		if err != nil {
+			return 0, err
+		}
+		s.stream = stream
+	}
+	return s.stream.Write(p)
+}
+
+func (s *streamCompressor) Close() error {
+	if s.stream == nil {
+		return nil
+	}
+	err := s.stream.Close()
+	s.stream = nil
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// countingWriter keeps track of the number of bytes written to a chunk
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+/*
+ * The dumpWriter writes messages to one file or, when compression or a limit is used, to numbered chunks together
+ * with a manifest. The file size limit is checked after every message and applies to the (compressed) bytes written
+ * so far, so a chunk can be somewhat larger than the limit. For the resumable formats a checkpoint is written every
+ * checkpointInterval.
+ */
+type dumpWriter struct {
+	fileName       string
+	decoders       messageDecoders
+	args           Args
+	chunked        bool
+	resumable      bool
+	maxBytes       int64
+	maxRecords     int
+	manifest       dumpManifest
+	offsets        map[int32]int64
+	lastCheckpoint time.Time
+	file           *os.File
+	counter        *countingWriter
+	compressor     *streamCompressor
+	records        recordWriter
+	chunkRecords   int
+}
+
+func newDumpWriter(fileName string, topic string, decoders messageDecoders, args Args) (*dumpWriter, error) {
+	if _, ok := recordFormats[strings.ToLower(args.RecordFormat)]; !ok {
+		return nil, usageErrorf("unknown record format %s (JSON/NDJSON/CSV/avro/parquet/raw)", args.RecordFormat)
+	}
+	d := &dumpWriter{
+		fileName:       fileName,
+		decoders:       decoders,
+		args:           args,
+		resumable:      resumableFormats[strings.ToLower(args.RecordFormat)],
+		maxRecords:     args.MaxRecordsPerFile,
+		offsets:        map[int32]int64{},
+		lastCheckpoint: time.Now(),
+		manifest: dumpManifest{
+			Topic:        topic,
+			RecordFormat: strings.ToLower(args.RecordFormat),
+			Compression:  args.Compress,
+			Created:      time.Now(),
+			Partitions:   []manifestPartition{},
+			Files:        []manifestFile{},
+		},
+	}
+	if args.MaxFileSize != "" {
+		maxBytes, err := parseSize(args.MaxFileSize)
+		if err != nil {
+			return nil, usageErrorf("invalid --max-file-size: %v", err)
+		}
+		d.maxBytes = maxBytes
+	}
+	d.chunked = args.Compress != "" || d.maxBytes > 0 || d.maxRecords > 0
+	if args.Resume {
+		return d, d.resumeChunk()
+	}
+	// a checkpoint of an earlier dump to the same file no longer matches it
+	if err := os.Remove(d.checkpointName()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return d, d.openChunk()
+}
+
+// resumeChunk continues the last file of the checkpoint after the last complete message
+func (d *dumpWriter) resumeChunk() error {
+	if !d.resumable {
+		return usageErrorf("cannot resume a dump in the %s format (JSON/NDJSON/CSV/raw)", d.args.RecordFormat)
+	}
+	checkpoint, err := loadCheckpoint(d.checkpointName())
+	if errors.Is(err, os.ErrNotExist) {
+		return usageErrorf("cannot resume: there is no checkpoint %s", d.checkpointName())
+	} else if err != nil {
+		return err
+	}
+	m := checkpoint.Manifest
+	if m.Topic != d.manifest.Topic || m.RecordFormat != d.manifest.RecordFormat || m.Compression != d.manifest.Compression {
+		return usageErrorf("cannot resume: the checkpoint is for topic %s with record format %s and compression '%s'", m.Topic, m.RecordFormat, m.Compression)
+	}
+
+	last := m.Files[len(m.Files)-1]
+	name := filepath.Join(filepath.Dir(d.fileName), last.Name)
+	f, err := os.OpenFile(name, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open file %s: %w", name, err)
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() < last.Bytes {
+		err = fmt.Errorf("file %s is smaller than at the checkpoint", name)
+	}
+	if err == nil {
+		// drop whatever was written after the checkpoint, e.g. a partial message or the end of a JSON array
+		err = f.Truncate(last.Bytes)
+	}
+	if err == nil {
+		_, err = f.Seek(last.Bytes, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	d.manifest = m
+	d.offsets = checkpoint.Offsets
+	d.file = f
+	d.counter = &countingWriter{w: f, count: last.Bytes}
+	d.compressor = &streamCompressor{compression: d.args.Compress, w: d.counter}
+	if d.records, err = newRecordWriter(d.compressor, d.decoders, d.args, true); err != nil {
+		return err
+	}
+	d.chunkRecords = last.Records
+	return nil
+}
+
+// resumeOffsets returns the offsets to continue consuming from (empty unless resuming)
+func (d *dumpWriter) resumeOffsets() map[int32]int64 {
+	offsets := map[int32]int64{}
+	for p, o := range d.offsets {
+		offsets[p] = o + 1
+	}
+	return offsets
+}
+
+func (d *dumpWriter) chunkName() string {
+	if !d.chunked {
+		return d.fileName
+	}
+	name := d.fileName
+	if d.maxBytes > 0 || d.maxRecords > 0 {
+		extension := filepath.Ext(d.fileName)
+		name = fmt.Sprintf("%s-%05d%s", strings.TrimSuffix(d.fileName, extension), len(d.manifest.Files)+1, extension)
+	}
+	return name + compressionExtensions[d.args.Compress]
+}
+
+func (d *dumpWriter) openChunk() error {
+	name := d.chunkName()
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %w", name, err)
+	}
+	d.file = f
+	d.counter = &countingWriter{w: f}
+	if d.compressor, err = newStreamCompressor(d.args.Compress, d.counter); err != nil {
+		return err
+	}
+	if d.records, err = newRecordWriter(d.compressor, d.decoders, d.args, false); err != nil {
+		return err
+	}
+	d.chunkRecords = 0
+	d.manifest.Files = append(d.manifest.Files, manifestFile{Name: filepath.Base(name)})
+	return nil
+}
+
+func (d *dumpWriter) closeChunk() error {
+	if err := d.records.close(); err != nil {
+		return err
+	}
+	if err := d.compressor.Close(); err != nil {
+		return err
+	}
+	file := &d.manifest.Files[len(d.manifest.Files)-1]
+	file.Records = d.chunkRecords
+	file.Bytes = d.counter.count
+	return d.file.Close()
+}
+
+func (d *dumpWriter) write(msg sarama.ConsumerMessage) error {
+	if (d.maxRecords > 0 && d.chunkRecords >= d.maxRecords) || (d.maxBytes > 0 && d.counter.count >= d.maxBytes) {
+		if err := d.closeChunk(); err != nil {
+			return err
+		}
+		if err := d.openChunk(); err != nil {
+			return err
+		}
+	}
+	if err := d.records.write(msg); err != nil {
+		return err
+	}
+	d.chunkRecords++
+	d.manifest.add(msg)
+	return d.consumed(msg)
+}
+
+// skip keeps track of a message that was filtered out so that a resumed dump does not read it again
+func (d *dumpWriter) skip(msg sarama.ConsumerMessage) error {
+	return d.consumed(msg)
+}
+
+func (d *dumpWriter) consumed(msg sarama.ConsumerMessage) error {
+	d.offsets[msg.Partition] = msg.Offset
+	if time.Since(d.lastCheckpoint) < checkpointInterval {
+		return nil
+	}
+	return d.checkpoint()
+}
+
+// checkpoint makes sure everything written so far is complete on disk and writes the checkpoint file
+func (d *dumpWriter) checkpoint() error {
+	// an empty chunk is not written to the checkpoint - a resumed dump continues the previous chunk instead
+	if !d.resumable || d.chunkRecords == 0 {
+		return nil
+	}
+	if f, ok := d.records.(interface{ flush() error }); ok {
+		if err := f.flush(); err != nil {
+			return err
+		}
+	}
+	if err := d.compressor.Close(); err != nil {
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	file := &d.manifest.Files[len(d.manifest.Files)-1]
+	file.Records = d.chunkRecords
+	file.Bytes = d.counter.count
+
+	b, err := json.MarshalIndent(dumpCheckpoint{Updated: time.Now(), Offsets: d.offsets, Manifest: d.manifest}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write and rename so that an interrupted run never leaves a half written checkpoint
+	tempName := d.checkpointName() + ".tmp"
+	if err = os.WriteFile(tempName, b, 0644); err != nil {
+		return err
+	}
+	d.lastCheckpoint = time.Now()
+	return os.Rename(tempName, d.checkpointName())
+}
+
+// close finishes the last chunk and writes the manifest
+func (d *dumpWriter) close() error {
+	// the checkpoint is kept so that a later run can --resume and add the messages produced since
+	if err := d.checkpoint(); err != nil {
+		return err
+	}
+	if err := d.closeChunk(); err != nil {
+		return err
+	}
+	if !d.chunked {
+		return nil
+	}
+	b, err := json.MarshalIndent(d.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.manifestName(), b, 0644)
+}
+
+func (d *dumpWriter) manifestName() string {
+	return strings.TrimSuffix(d.fileName, filepath.Ext(d.fileName)) + manifestSuffix
+}
+
+func (d *dumpWriter) checkpointName() string {
+	return strings.TrimSuffix(d.fileName, filepath.Ext(d.fileName)) + checkpointSuffix
+}
+
+// files returns the names of the written files (including the manifest)
+func (d *dumpWriter) files() []string {
+	files := []string{}
+	dir := filepath.Dir(d.fileName)
+	for _, f := range d.manifest.Files {
+		files = append(files, filepath.Join(dir, f.Name))
+	}
+	if d.chunked {
+		files = append(files, d.manifestName())
+	}
+	if _, err := os.Stat(d.checkpointName()); err == nil {
+		files = append(files, d.checkpointName())
+	}
+	return files
+}
+
+// dumpChunks returns the files to import in order with their record format and compression
+func dumpChunks(fileName string) ([]string, dumpManifest, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil, dumpManifest{}, err
+	}
+	if info.IsDir() {
+		manifests, err := filepath.Glob(filepath.Join(fileName, "*"+manifestSuffix))
+		if err != nil {
+			return nil, dumpManifest{}, err
+		}
+		if len(manifests) != 1 {
+			return nil, dumpManifest{}, fmt.Errorf("expected one %s file in directory %s but found %d", manifestSuffix, fileName, len(manifests))
+		}
+		fileName = manifests[0]
+	}
+	if !strings.HasSuffix(fileName, manifestSuffix) {
+		// a plain, uncompressed dump in the JSON or NDJSON format
+		format, err := sniffRecordFormat(fileName)
+		if err != nil {
+			return nil, dumpManifest{}, err
+		}
+		return []string{fileName}, dumpManifest{RecordFormat: format}, nil
+	}
+
+	manifest, err := loadManifest(fileName)
+	if err != nil {
+		return nil, manifest, err
+	}
+	chunks := []string{}
+	for _, f := range manifest.Files {
+		chunks = append(chunks, filepath.Join(filepath.Dir(fileName), f.Name))
+	}
+	return chunks, manifest, nil
+}
+
+// sniffRecordFormat tells a JSON dump (an array) from an NDJSON dump (one object per line) by its first non-whitespace byte
+func sniffRecordFormat(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("cannot import %s: the file is empty", fileName)
+		} else if err != nil {
+			return "", err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return "json", nil
+		case '{':
+			return "ndjson", nil
+		default:
+			return "", fmt.Errorf("cannot import %s: only JSON and NDJSON dumps can be imported", fileName)
+		}
+	}
+}
+
+// readDumpChunk calls handle for every message in a chunk written in the JSON or NDJSON format
+func readDumpChunk(fileName string, manifest dumpManifest, handle func(msg sarama.ConsumerMessage) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompressor(manifest.Compression, f)
+	if err != nil {
+		return fmt.Errorf("could not decompress %s: %w", fileName, err)
+	}
+	defer r.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	switch manifest.RecordFormat {
+	case "json":
+		// stream the array instead of reading the whole chunk into memory
+		if _, err = decoder.Token(); err != nil {
+			return fmt.Errorf("invalid JSON in %s: %w", fileName, err)
+		}
+		for decoder.More() {
+			msg := sarama.ConsumerMessage{}
+			if err = decoder.Decode(&msg); err != nil {
+				return fmt.Errorf("invalid JSON in %s: %w", fileName, err)
+			}
+			if err = handle(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "ndjson":
+		for {
+			msg := sarama.ConsumerMessage{}
+			if err = decoder.Decode(&msg); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("invalid JSON in %s: %w", fileName, err)
+			}
+			if err = handle(msg); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot import %s: only JSON and NDJSON dumps can be imported", fileName)
+	}
+}
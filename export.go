@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/linkedin/goavro/v2"
+	"github.com/parquet-go/parquet-go"
+)
+
+// recordWriter writes consumed messages to a file in one of the --record-format formats
+type recordWriter interface {
+	write(msg sarama.ConsumerMessage) error
+	// close finishes the file (e.g. the closing bracket of a JSON array) but does not close the underlying writer
+	close() error
+}
+
+// appending is true when the writer continues a file written by an earlier run (see --resume)
+type recordWriterFactory func(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error)
+
+var recordFormats = map[string]recordWriterFactory{
+	"json":    newJsonRecordWriter,
+	"ndjson":  newNdjsonRecordWriter,
+	"csv":     newCsvRecordWriter,
+	"avro":    newAvroRecordWriter,
+	"parquet": newParquetRecordWriter,
+	"raw":     newRawRecordWriter,
+}
+
+func newRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	factory, ok := recordFormats[strings.ToLower(args.RecordFormat)]
+	if !ok {
+		return nil, usageErrorf("unknown record format %s (JSON/NDJSON/CSV/avro/parquet/raw)", args.RecordFormat)
+	}
+	return factory(w, decoders, args, appending)
+}
+
+// JSON writes an array of StoredMessage - the format importMessages reads
+type jsonRecordWriter struct {
+	w        io.Writer
+	decoders messageDecoders
+	first    bool
+}
+
+func newJsonRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	if appending {
+		// the file already holds the opening bracket and at least one message
+		return &jsonRecordWriter{w: w, decoders: decoders, first: false}, nil
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &jsonRecordWriter{w: w, decoders: decoders, first: true}, nil
+}
+
+func (j *jsonRecordWriter) write(msg sarama.ConsumerMessage) error {
+	b, err := json.MarshalIndent(j.decoders.decode(msg), "", "    ")
+	if err != nil {
+		return err
+	}
+	if !j.first {
+		b = append([]byte(","), b...)
+	}
+	j.first = false
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonRecordWriter) close() error {
+	_, err := io.WriteString(j.w, "]")
+	return err
+}
+
+// NDJSON writes one StoredMessage per line
+type ndjsonRecordWriter struct {
+	encoder  *json.Encoder
+	decoders messageDecoders
+}
+
+func newNdjsonRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	return &ndjsonRecordWriter{encoder: json.NewEncoder(w), decoders: decoders}, nil
+}
+
+func (n *ndjsonRecordWriter) write(msg sarama.ConsumerMessage) error {
+	return n.encoder.Encode(n.decoders.decode(msg))
+}
+
+func (n *ndjsonRecordWriter) close() error {
+	return nil
+}
+
+// raw writes the values only, one per line
+type rawRecordWriter struct {
+	w io.Writer
+}
+
+func newRawRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	return &rawRecordWriter{w: w}, nil
+}
+
+func (r *rawRecordWriter) write(msg sarama.ConsumerMessage) error {
+	if _, err := r.w.Write(msg.Value); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.w, "\n")
+	return err
+}
+
+func (r *rawRecordWriter) close() error {
+	return nil
+}
+
+/*
+ * CSV writes one row per message with the --columns. A column is one of topic, partition, offset, timestamp, key,
+ * value and headers, 'header.<name>' for a single header or 'key.<path>'/'value.<path>' for a field of a decoded JSON
+ * key or value, e.g. 'value.customer.id' or 'value.items[0].sku'.
+ */
+type csvRecordWriter struct {
+	w        *csv.Writer
+	decoders messageDecoders
+	columns  []string
+}
+
+const defaultCsvColumns = "partition,offset,timestamp,key,value"
+
+func newCsvRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	columns := splitPatterns(args.Columns)
+	if len(columns) == 0 {
+		columns = splitPatterns(defaultCsvColumns)
+	}
+	for _, c := range columns {
+		switch {
+		case c == "topic", c == "partition", c == "offset", c == "timestamp", c == "key", c == "value", c == "headers":
+		case strings.HasPrefix(c, "header."), strings.HasPrefix(c, "key."), strings.HasPrefix(c, "value."):
+		default:
+			return nil, usageErrorf("unknown CSV column %s", c)
+		}
+	}
+	c := &csvRecordWriter{w: csv.NewWriter(w), decoders: decoders, columns: columns}
+	if appending {
+		return c, nil
+	}
+	if err := c.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvRecordWriter) write(msg sarama.ConsumerMessage) error {
+	key := c.decoders.keyText(msg)
+	value := c.decoders.valueText(msg)
+	row := []string{}
+	for _, column := range c.columns {
+		switch {
+		case column == "topic":
+			row = append(row, msg.Topic)
+		case column == "partition":
+			row = append(row, strconv.Itoa(int(msg.Partition)))
+		case column == "offset":
+			row = append(row, strconv.FormatInt(msg.Offset, 10))
+		case column == "timestamp":
+			row = append(row, msg.Timestamp.UTC().Format(time.RFC3339Nano))
+		case column == "key":
+			row = append(row, key)
+		case column == "value":
+			row = append(row, value)
+		case column == "headers":
+			headers := map[string]string{}
+			for _, h := range msg.Headers {
+				headers[string(h.Key)] = string(h.Value)
+			}
+			b, _ := json.Marshal(headers)
+			row = append(row, string(b))
+		case strings.HasPrefix(column, "header."):
+			row = append(row, headerValue(msg, strings.TrimPrefix(column, "header.")))
+		case strings.HasPrefix(column, "key."):
+			row = append(row, jsonField(key, strings.TrimPrefix(column, "key.")))
+		case strings.HasPrefix(column, "value."):
+			row = append(row, jsonField(value, strings.TrimPrefix(column, "value.")))
+		}
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvRecordWriter) close() error {
+	return c.flush()
+}
+
+func (c *csvRecordWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func headerValue(msg sarama.ConsumerMessage, name string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == name {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// jsonField returns the field at the path (e.g. 'customer.id' or 'items[0].sku') of a JSON document or "" if it does not exist
+func jsonField(document string, path string) string {
+	var v any
+	if json.Unmarshal([]byte(document), &v) != nil {
+		return ""
+	}
+	for _, part := range strings.Split(strings.ReplaceAll(path, "[", ".["), ".") {
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]") {
+			index, err := strconv.Atoi(part[1 : len(part)-1])
+			list, ok := v.([]any)
+			if err != nil || !ok || index < 0 || index >= len(list) {
+				return ""
+			}
+			v = list[index]
+			continue
+		}
+		object, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		if v, ok = object[part]; !ok {
+			return ""
+		}
+	}
+
+	switch field := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return field
+	default:
+		b, _ := json.Marshal(field)
+		return string(b)
+	}
+}
+
+// exportRecord is the schema of the avro and parquet formats
+type exportRecord struct {
+	Topic        string         `parquet:"topic"`
+	Partition    int32          `parquet:"partition"`
+	Offset       int64          `parquet:"offset"`
+	Timestamp    int64          `parquet:"timestamp,timestamp(millisecond)"`
+	Key          *[]byte        `parquet:"key,optional"`
+	Value        *[]byte        `parquet:"value,optional"`
+	Headers      []exportHeader `parquet:"headers,list"`
+	DecodedKey   *string        `parquet:"decoded_key,optional"`
+	DecodedValue *string        `parquet:"decoded_value,optional"`
+}
+
+type exportHeader struct {
+	Key   string `parquet:"key"`
+	Value []byte `parquet:"value"`
+}
+
+// decodedText returns the decoded payload if decoding changed it
+func decodedText(data []byte, decoded string, err error) *string {
+	if err != nil || decoded == string(data) {
+		return nil
+	}
+	return &decoded
+}
+
+func newExportRecord(decoders messageDecoders, msg sarama.ConsumerMessage) exportRecord {
+	record := exportRecord{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp.UnixMilli(),
+		Headers:   []exportHeader{},
+	}
+	// nil keys and values (e.g. tombstones) are stored as null
+	if msg.Key != nil {
+		record.Key = &msg.Key
+	}
+	if msg.Value != nil {
+		record.Value = &msg.Value
+	}
+	for _, h := range msg.Headers {
+		record.Headers = append(record.Headers, exportHeader{Key: string(h.Key), Value: h.Value})
+	}
+	key, err := decoders.key.Decode(msg.Key)
+	record.DecodedKey = decodedText(msg.Key, key, err)
+	value, err := decoders.valueDecoder(msg.Topic).Decode(msg.Value)
+	record.DecodedValue = decodedText(msg.Value, value, err)
+	return record
+}
+
+const avroExportSchema = `{
+  "type": "record",
+  "name": "KafkaMessage",
+  "namespace": "jokk",
+  "fields": [
+    {"name": "topic", "type": "string"},
+    {"name": "partition", "type": "int"},
+    {"name": "offset", "type": "long"},
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "key", "type": ["null", "bytes"]},
+    {"name": "value", "type": ["null", "bytes"]},
+    {"name": "headers", "type": {"type": "array", "items": {
+      "type": "record", "name": "Header", "fields": [
+        {"name": "key", "type": "string"},
+        {"name": "value", "type": "bytes"}
+      ]}}},
+    {"name": "decoded_key", "type": ["null", "string"]},
+    {"name": "decoded_value", "type": ["null", "string"]}
+  ]
+}`
+
+// Records are appended to Avro files in blocks and Parquet files are written in row groups, both of this many records
+const (
+	avroBlockSize       = 1000
+	parquetRowGroupSize = 10000
+)
+
+// avro writes an Avro object container file with the avroExportSchema
+type avroRecordWriter struct {
+	w        *goavro.OCFWriter
+	decoders messageDecoders
+	// block holds the records of the next block of the file
+	block []any
+}
+
+func newAvroRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	ocf, err := goavro.NewOCFWriter(goavro.OCFConfig{W: w, Schema: avroExportSchema})
+	if err != nil {
+		return nil, err
+	}
+	return &avroRecordWriter{w: ocf, decoders: decoders}, nil
+}
+
+func (a *avroRecordWriter) write(msg sarama.ConsumerMessage) error {
+	r := newExportRecord(a.decoders, msg)
+	headers := []any{}
+	for _, h := range r.Headers {
+		headers = append(headers, map[string]any{"key": h.Key, "value": h.Value})
+	}
+	native := map[string]any{
+		"topic":         r.Topic,
+		"partition":     r.Partition,
+		"offset":        r.Offset,
+		"timestamp":     time.UnixMilli(r.Timestamp),
+		"key":           nil,
+		"value":         nil,
+		"headers":       headers,
+		"decoded_key":   nil,
+		"decoded_value": nil,
+	}
+	if r.Key != nil {
+		native["key"] = goavro.Union("bytes", *r.Key)
+	}
+	if r.Value != nil {
+		native["value"] = goavro.Union("bytes", *r.Value)
+	}
+	if r.DecodedKey != nil {
+		native["decoded_key"] = goavro.Union("string", *r.DecodedKey)
+	}
+	if r.DecodedValue != nil {
+		native["decoded_value"] = goavro.Union("string", *r.DecodedValue)
+	}
+	a.block = append(a.block, native)
+	if len(a.block) < avroBlockSize {
+		return nil
+	}
+	return a.flush()
+}
+
+func (a *avroRecordWriter) flush() error {
+	if len(a.block) == 0 {
+		return nil
+	}
+	err := a.w.Append(a.block)
+	a.block = a.block[:0]
+	return err
+}
+
+func (a *avroRecordWriter) close() error {
+	return a.flush()
+}
+
+// parquet writes a Parquet file with the schema of exportRecord
+type parquetRecordWriter struct {
+	w        *parquet.GenericWriter[exportRecord]
+	decoders messageDecoders
+}
+
+func newParquetRecordWriter(w io.Writer, decoders messageDecoders, args Args, appending bool) (recordWriter, error) {
+	// without a limit the whole file would be kept in memory as a single row group until it is closed
+	writer := parquet.NewGenericWriter[exportRecord](w, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))
+	return &parquetRecordWriter{w: writer, decoders: decoders}, nil
+}
+
+func (p *parquetRecordWriter) write(msg sarama.ConsumerMessage) error {
+	_, err := p.w.Write([]exportRecord{newExportRecord(p.decoders, msg)})
+	return err
+}
+
+func (p *parquetRecordWriter) close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// topicMatcher decides what topics a filter applies to
+type topicMatcher struct {
+	includes        []func(string) bool
+	excludes        []func(string) bool
+	names           map[string]bool
+	includeInternal bool
+}
+
+/*
+ * Creates a matcher from the -f/filter, --exclude and --include-internal arguments.
+ * The filter is a comma separated list of patterns where each pattern is either a regular expression ('re:' prefix),
+ * a shell glob (if it contains any of '*?[') or a plain substring. Patterns starting with '!' exclude topics.
+ */
+func newTopicMatcher(args Args) (topicMatcher, error) {
+	matcher := topicMatcher{names: make(map[string]bool), includeInternal: args.IncludeInternal}
+	patterns := splitPatterns(args.Filter)
+	for _, e := range args.Exclude {
+		for _, p := range splitPatterns(e) {
+			patterns = append(patterns, "!"+strings.TrimPrefix(p, "!"))
+		}
+	}
+
+	for _, p := range patterns {
+		exclude := strings.HasPrefix(p, "!")
+		match, err := patternMatcher(strings.TrimPrefix(p, "!"))
+		if err != nil {
+			return matcher, err
+		}
+		if exclude {
+			matcher.excludes = append(matcher.excludes, match)
+		} else {
+			matcher.includes = append(matcher.includes, match)
+			if isNamePattern(p) {
+				matcher.names[p] = true
+			}
+		}
+	}
+	return matcher, nil
+}
+
+func splitPatterns(filter string) []string {
+	patterns := []string{}
+	for _, p := range strings.Split(filter, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func patternMatcher(pattern string) (func(string) bool, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression in filter '%s': %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob in filter '%s': %v", pattern, err)
+		}
+		return func(topic string) bool {
+			matched, _ := path.Match(pattern, topic)
+			return matched
+		}, nil
+	}
+	return func(topic string) bool {
+		return strings.Contains(topic, pattern)
+	}, nil
+}
+
+// isNamePattern returns true for a pattern that is neither a regular expression nor a glob
+func isNamePattern(pattern string) bool {
+	return !strings.HasPrefix(pattern, "re:") && !strings.ContainsAny(pattern, "*?[")
+}
+
+// namePatternMatcher is like patternMatcher but a pattern without glob characters must match the whole topic name
+func namePatternMatcher(pattern string) (func(string) bool, error) {
+	if !isNamePattern(pattern) {
+		return patternMatcher(pattern)
+	}
+	return func(topic string) bool {
+		return topic == pattern
+	}, nil
+}
+
+// isInternalTopic returns true for topics used by Kafka and its ecosystem: __consumer_offsets and the other '__' topics, _schemas and the _confluent topics
+func isInternalTopic(topic string) bool {
+	return strings.HasPrefix(topic, "__") || topic == "_schemas" || strings.HasPrefix(topic, "_confluent")
+}
+
+/*
+ * matches applies the patterns. Internal topics are only included with --include-internal or when an include pattern
+ * is their exact name, so that e.g. '*' or 'offsets' does not pick up __consumer_offsets.
+ */
+func (m topicMatcher) matches(topic string) bool {
+	for _, exclude := range m.excludes {
+		if exclude(topic) {
+			return false
+		}
+	}
+	if len(m.includes) == 0 {
+		return m.includeInternal || !isInternalTopic(topic)
+	}
+	if isInternalTopic(topic) && !m.includeInternal {
+		return m.names[topic]
+	}
+	for _, include := range m.includes {
+		if include(topic) {
+			return true
+		}
+	}
+	return false
+}
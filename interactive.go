@@ -1,17 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	"github.com/gdamore/tcell/v2"
 	"github.com/henrikengstrom/jokk/common"
 	"github.com/henrikengstrom/jokk/kafka"
+	"github.com/henrikengstrom/jokk/schemaregistry"
 	"github.com/rivo/tview"
 )
 
@@ -25,6 +32,8 @@ type EnvCtrl struct {
 	admin          sarama.ClusterAdmin
 	client         sarama.Client
 	consumer       kafka.JokkConsumer
+	registry       *schemaregistry.Client
+	decoders       messageDecoders
 	args           Args
 	kafkaHost      string
 	consumerConfig *sarama.Config
@@ -40,7 +49,18 @@ type UiCtrl struct {
 	commandArea *tview.TextView
 }
 
+// update shows a page from a goroutine other than the UI goroutine and draws it
 func update(ctrl *Ctrl, ma tview.Primitive, capture func(event *tcell.EventKey) *tcell.EventKey) {
+	layout(ctrl, ma, capture)
+	ctrl.uic.app.Draw()
+}
+
+/*
+ * layout shows a page without drawing it. It is used on the UI goroutine (in input captures, form callbacks and queued
+ * updates): Draw queues an update and waits for the event loop, which would be waiting for the caller. Key events are
+ * drawn by the event loop once they have been handled and queued updates use QueueUpdateDraw.
+ */
+func layout(ctrl *Ctrl, ma tview.Primitive, capture func(event *tcell.EventKey) *tcell.EventKey) {
 	ia := ctrl.uic.infoArea
 	ca := ctrl.uic.commandArea
 	ctrl.uic.grid = nil
@@ -54,12 +74,13 @@ func update(ctrl *Ctrl, ma tview.Primitive, capture func(event *tcell.EventKey)
 	grid.SetInputCapture(capture)
 	ctrl.uic.grid = grid
 	ctrl.uic.app.SetRoot(grid, true)
-	ctrl.uic.app.Draw()
 }
 
-func MainLoop(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, consumer kafka.JokkConsumer, consumerConfig *sarama.Config, producerConf *sarama.Config, args Args, kafkaHost string) {
+func MainLoop(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, consumer kafka.JokkConsumer, registry *schemaregistry.Client, decoders messageDecoders, consumerConfig *sarama.Config, producerConf *sarama.Config, args Args, kafkaHost string) {
 	app := tview.NewApplication()
 	wg := sync.WaitGroup{}
+	// results are rendered by the UI and must never be written to stdout
+	args.Output = OutputTable
 	wg.Add(1)
 
 	envCtrl := EnvCtrl{
@@ -67,6 +88,8 @@ func MainLoop(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client
 		admin:          admin,
 		client:         client,
 		consumer:       consumer,
+		registry:       registry,
+		decoders:       decoders,
 		args:           args,
 		kafkaHost:      kafkaHost,
 		consumerConfig: consumerConfig,
@@ -201,7 +224,6 @@ func topicsPage(ctrl *Ctrl, pickedRow ...int) {
 			// comes from a dialogue/modal window or not
 			// IS THIS BEING INVOKED BY THE MODAL WINDOW ENTER KEY???
 			topicName := table.GetCell(selectedRow, 1).Text
-			topicDetails, _, _ := filterTopics(topicDetails, topicName)
 			topicDetail := topicDetails[topicName]
 			ctrl.uic.grid.RemoveItem(table)
 			go topicInfoPage(ctrl, topicName, topicDetail)
@@ -224,6 +246,12 @@ func topicsPage(ctrl *Ctrl, pickedRow ...int) {
 				AddInputField("Use filter", ctrl.env.args.Filter, 75, nil, nil).
 				AddButton("Set", func() {
 					filter := form.GetFormItem(0).(*tview.InputField).GetText()
+					filterArgs := ctrl.env.args
+					filterArgs.Filter = filter
+					if _, err := newTopicMatcher(filterArgs); err != nil {
+						form.SetTitle(fmt.Sprintf("Add filter - %v", err))
+						return
+					}
 					ctrl.env.args.Filter = filter
 					ctrl.uic.grid.RemoveItem(form)
 					form = nil
@@ -296,10 +324,9 @@ func topicsPage(ctrl *Ctrl, pickedRow ...int) {
 				AddInputField("Write messages to file", fmt.Sprintf("%s_%s.json", topicName, now), 75, nil, nil).
 				AddButton("Save", func() {
 					fileName := form.GetFormItem(0).(*tview.InputField).GetText()
-					storeMessages(ctrl.env.logger, fileName, topicName, ctrl.env.consumer, ctrl.env.args)
 					ctrl.uic.grid.RemoveItem(form)
 					form = nil
-					go topicsPage(ctrl, selectedRow)
+					saveMessages(ctrl, topicName, fileName, func() { topicsPage(ctrl, selectedRow) })
 				}).
 				AddButton("Cancel", func() {
 					go topicsPage(ctrl, selectedRow)
@@ -317,9 +344,9 @@ func topicsPage(ctrl *Ctrl, pickedRow ...int) {
 
 func topicInfoPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail) {
 	start := time.Now()
-	tdi, msg24h, msg1h, msg1m := topicInfo(ctrl.env.logger, topicName, topicDetail, ctrl.env.admin, ctrl.env.client)
+	tdi, msg24h, msg1h, msg1m := topicInfo(ctrl.env.logger, topicName, topicDetail, ctrl.env.admin, ctrl.env.client, ctrl.env.args)
 	ctrl.uic.infoArea.SetText(fmt.Sprintf("%s\n\nTopic information retrieval time %dms @ %s", infoText(&ctrl.env), time.Since(start).Milliseconds(), start.Format(time.RFC3339)))
-	ctrl.uic.commandArea.SetText("e:Clear/Empty Topic, s:Save Messages, l:List Topics, z:Refresh Page, m:Info, q:Quit")
+	ctrl.uic.commandArea.SetText("e:Clear/Empty Topic, v:View Messages, s:Save Messages, k:Get Key, c:Compaction Report, a:ACLs, g:Schemas, l:List Topics, z:Refresh Page, m:Info, q:Quit")
 
 	table := tview.NewTable().
 		SetSelectable(false, false).
@@ -385,14 +412,16 @@ func topicInfoPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail)
 		table.SetCell(i+1, 13, &tview.TableCell{Text: fmt.Sprintf("%d", msg1mCount), Align: tview.AlignCenter, Color: tcell.ColorWhite})
 	}
 
+	var main tview.Primitive = table
 	var modal *tview.Modal
-	capture := func(event *tcell.EventKey) *tcell.EventKey {
+	var capture func(event *tcell.EventKey) *tcell.EventKey
+	capture = func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Rune() {
 		case 'q':
 			ctrl.uic.app.Stop()
 			os.Exit(0)
 		case 'e': // clear/empty topic - pop up modal to make sure
-			ctrl.uic.grid.RemoveItem(table)
+			ctrl.uic.grid.RemoveItem(main)
 			modal = tview.NewModal().
 				SetText(fmt.Sprintf("Are you sure you want to clear/empty topic: %s?", topicName)).
 				AddButtons([]string{"Yes", "No"}).
@@ -406,31 +435,57 @@ func topicInfoPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail)
 				})
 
 			ctrl.uic.app.SetRoot(modal, true).SetFocus(modal).Run()
-			// View messages is not working yet
-		//case 'v':
-		//	go pageViewMessages(ctrl, topicName, topicDetail)
+		case 'v': // view messages
+			ctrl.uic.grid.RemoveItem(main)
+			go pageViewMessages(ctrl, topicName, topicDetail)
 		case 'z': // refresh
-			ctrl.uic.grid.RemoveItem(table)
+			ctrl.uic.grid.RemoveItem(main)
 			go topicInfoPage(ctrl, topicName, topicDetail)
+		case 'k': // latest value of a key
+			ctrl.uic.grid.RemoveItem(main)
+			keyLookupForm(ctrl, topicName, topicDetail)
+		case 'c': // compaction report panel below the partitions
+			panel := tview.NewTextView().SetText("Scanning the topic for the compaction report...")
+			main = tview.NewFlex().
+				SetDirection(tview.FlexRow).
+				AddItem(table, 0, 1, false).
+				AddItem(panel, 0, 1, false)
+			layout(ctrl, main, capture)
+			// the scan reads the whole topic, so it runs in the background and its result is shown on the UI goroutine
+			go func() {
+				report, err := compactionReport(ctrl.env.admin, ctrl.env.client, topicName)
+				ctrl.uic.app.QueueUpdateDraw(func() {
+					if err != nil {
+						panel.SetText(fmt.Sprintf("Could not create the compaction report: %v", err))
+					} else {
+						panel.SetText(fmt.Sprintf("%s\n%s", CreateCompactionTable(report), strings.Join(compactionFindings(report), "\n")))
+					}
+				})
+			}()
+		case 'a': // ACLs that apply to the topic
+			ctrl.uic.grid.RemoveItem(main)
+			go topicAclsPage(ctrl, topicName, topicDetail)
+		case 'g': // schema registry subjects of the topic
+			ctrl.uic.grid.RemoveItem(main)
+			go topicSchemasPage(ctrl, topicName, topicDetail)
 		case 'l': // list topics
-			ctrl.uic.grid.RemoveItem(table)
+			ctrl.uic.grid.RemoveItem(main)
 			go topicsPage(ctrl)
 		case 'm': // main window
-			ctrl.uic.grid.RemoveItem(table)
+			ctrl.uic.grid.RemoveItem(main)
 			go infoPage(ctrl)
 
 		case 's': // save messages
-			ctrl.uic.grid.RemoveItem(table)
+			ctrl.uic.grid.RemoveItem(main)
 			form := tview.NewForm()
 			now := time.Now().Format("2006-01-02T15:04:05")
 			form.
 				AddInputField("Write messages to file", fmt.Sprintf("%s_%s.json", topicName, now), 75, nil, nil).
 				AddButton("Save", func() {
 					fileName := form.GetFormItem(0).(*tview.InputField).GetText()
-					storeMessages(ctrl.env.logger, fileName, topicName, ctrl.env.consumer, ctrl.env.args)
 					ctrl.uic.grid.RemoveItem(form)
 					form = nil
-					go topicInfoPage(ctrl, topicName, topicDetail)
+					saveMessages(ctrl, topicName, fileName, func() { topicInfoPage(ctrl, topicName, topicDetail) })
 				}).
 				AddButton("Cancel", func() {
 					go topicInfoPage(ctrl, topicName, topicDetail)
@@ -442,66 +497,326 @@ func topicInfoPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail)
 		return event
 	}
 
-	update(ctrl, table, capture)
+	update(ctrl, main, capture)
 }
 
-func pageViewMessages(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail) {
-	resultChan := make(chan sarama.ConsumerMessage)
-	commandChan := make(chan string)
-	go viewMessages(topicName, ctrl.env.logger, ctrl.env.consumer, ctrl.env.args, resultChan, commandChan)
+// saveMessages stores the messages of a topic in the background and shows the result until a key is pressed to go back
+func saveMessages(ctrl *Ctrl, topicName string, fileName string, back func()) {
+	text := tview.NewTextView().SetText(fmt.Sprintf("Saving the messages of topic %s to %s...", topicName, fileName))
+	layout(ctrl, text, nil)
+	// there is no way to stop a run that follows the topic from the UI
+	args := ctrl.env.args
+	args.Follow = false
+	go func() {
+		err := storeMessages(ctrl.env.logger, fileName, topicName, ctrl.env.client, ctrl.env.consumer, ctrl.env.decoders, args)
+		ctrl.uic.app.QueueUpdateDraw(func() {
+			if err != nil {
+				text.SetText(fmt.Sprintf("Could not save the messages of topic %s: %v\n\nPress any key to go back", topicName, err))
+			} else {
+				text.SetText(fmt.Sprintf("Saved the messages of topic %s to %s\n\nPress any key to go back", topicName, fileName))
+			}
+			layout(ctrl, text, func(event *tcell.EventKey) *tcell.EventKey {
+				go back()
+				return nil
+			})
+		})
+	}()
+}
+
+// keyLookupForm asks for a key, its format and the partitioner of the producers before looking up the latest value of the key
+func keyLookupForm(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail) {
+	formats := []string{"string", "hex", "base64", "json", "int64", "uuid"}
+	partitioners := []string{"hash", "murmur2"}
+	format := ctrl.env.args.KeyFormat
+	if format == "auto" || !slices.Contains(formats, format) {
+		format = "string"
+	}
+	form := tview.NewForm()
+	form.
+		AddInputField("Key", ctrl.env.args.Key, 60, nil, nil).
+		AddDropDown("Key format", formats, slices.Index(formats, format), nil).
+		AddDropDown("Partitioner", partitioners, max(slices.Index(partitioners, ctrl.env.args.Partitioner), 0), nil).
+		AddButton("Look up", func() {
+			args := ctrl.env.args
+			args.Key = form.GetFormItem(0).(*tview.InputField).GetText()
+			_, args.KeyFormat = form.GetFormItem(1).(*tview.DropDown).GetCurrentOption()
+			_, args.Partitioner = form.GetFormItem(2).(*tview.DropDown).GetCurrentOption()
+			go topicKeyPage(ctrl, topicName, topicDetail, args)
+		}).
+		AddButton("Cancel", func() {
+			go topicInfoPage(ctrl, topicName, topicDetail)
+		})
+	form.SetBorder(true).SetTitle("Get key").SetTitleAlign(tview.AlignLeft)
+	ctrl.uic.app.SetRoot(form, true).SetFocus(form)
+}
+
+// topicKeyPage shows the latest message with the key given in args, read from the partition the key belongs to
+func topicKeyPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail, args Args) {
+	start := time.Now()
+	ctrl.uic.commandArea.SetText(fmt.Sprintf("k:Get Another Key, t:Topic %s, l:List Topics, m:Info, q:Quit", topicName))
+	text := tview.NewTextView().SetText(fmt.Sprintf("Looking up key %s...", args.Key))
+	update(ctrl, text, nil)
+
+	lookup, msg, err := getKey(ctrl.env.client, ctrl.env.decoders, topicName, args.Key, args)
+	switch {
+	case err != nil:
+		text.SetText(fmt.Sprintf("Could not look up key %s: %v", args.Key, err))
+	case msg == nil:
+		text.SetText(fmt.Sprintf("Key %s not found in partition %d (%d messages scanned)", args.Key, lookup.Partition, lookup.Scanned))
+	default:
+		timestampType, err := kafka.TopicConfigValue(ctrl.env.admin, topicName, "message.timestamp.type")
+		if err != nil {
+			timestampType = "unknown"
+		}
+		status := fmt.Sprintf("Latest value of key %s (%d messages scanned)", escapeTags(args.Key, "-"), lookup.Scanned)
+		if lookup.Tombstone {
+			status = fmt.Sprintf("Key %s was deleted - the latest message is a tombstone (%d messages scanned)", escapeTags(args.Key, "-"), lookup.Scanned)
+		}
+		text.SetDynamicColors(true).SetText(fmt.Sprintf("[green]%s[-]\n\n%s", status, messageDetailText(ctrl.env.decoders, *msg, timestampType)))
+	}
+	ctrl.uic.infoArea.SetText(fmt.Sprintf("%s\n\nKey lookup in topic %s took %dms @ %s", infoText(&ctrl.env), topicName, time.Since(start).Milliseconds(), start.Format(time.RFC3339)))
 
-	ctrl.uic.infoArea.SetText(fmt.Sprintf("%s\n\nViewing messages in topic %s", infoText(&ctrl.env), topicName))
-	ctrl.uic.commandArea.SetText(fmt.Sprintf("n:Next Message, z:Refresh, t:Topic %s, l:List Topics, m:Info, q:Quit", topicName))
 	capture := func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Rune() {
-		case 'n':
-			commandChan <- "Y"
-		case 'z':
-			resultChan = nil
-			commandChan <- "N"
-			commandChan = nil
-			// Create a new consumer to start from the beginning of messages
-			kc, err := kafka.NewConsumer(ctrl.env.logger, ctrl.env.kafkaHost, ctrl.env.consumerConfig)
-			if err != nil {
-				os.Exit(1)
+		case 'q':
+			ctrl.uic.app.Stop()
+			os.Exit(0)
+		case 'k':
+			ctrl.uic.grid.RemoveItem(text)
+			keyLookupForm(ctrl, topicName, topicDetail)
+		case 't':
+			ctrl.uic.grid.RemoveItem(text)
+			go topicInfoPage(ctrl, topicName, topicDetail)
+		case 'l':
+			ctrl.uic.grid.RemoveItem(text)
+			go topicsPage(ctrl)
+		case 'm':
+			ctrl.uic.grid.RemoveItem(text)
+			go infoPage(ctrl)
+		}
+
+		return event
+	}
+
+	update(ctrl, text, capture)
+}
+
+func topicAclsPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail) {
+	start := time.Now()
+	acls, err := kafka.TopicAcls(ctrl.env.admin, topicName)
+	ctrl.uic.infoArea.SetText(fmt.Sprintf("%s\n\nACLs for topic %s retrieved in %dms @ %s", infoText(&ctrl.env), topicName, time.Since(start).Milliseconds(), start.Format(time.RFC3339)))
+	ctrl.uic.commandArea.SetText(fmt.Sprintf("t:Topic %s, l:List Topics, z:Refresh Page, m:Info, q:Quit", topicName))
+
+	var main tview.Primitive
+	if err != nil {
+		main = tview.NewTextView().SetText(fmt.Sprintf("Could not retrieve ACLs for topic %s: %v", topicName, err))
+	} else if len(acls) == 0 {
+		main = tview.NewTextView().SetText(fmt.Sprintf("No ACLs apply to topic %s", topicName))
+	} else {
+		table := tview.NewTable().
+			SetSelectable(false, false).
+			SetFixed(1, 7).
+			SetBordersColor(tcell.ColorYellow)
+
+		headers := []string{
+			"PRINCIPAL",
+			"HOST",
+			"OPERATION",
+			"PERMISSION",
+			"PATTERN",
+			"RESOURCE NAME",
+		}
+		for index, name := range headers {
+			table.SetCell(0, index, &tview.TableCell{Text: name, Align: tview.AlignCenter, Color: tcell.ColorYellow})
+		}
+
+		var color tcell.Color
+		for c, acl := range acls {
+			if c%2 != 0 {
+				color = tcell.ColorGray
+			} else {
+				color = tcell.ColorWhite
 			}
-			ctrl.env.consumer = kc
-			go pageViewMessages(ctrl, topicName, topicDetail)
+			// make denied operations stand out since they are the most likely reason for authorization failures
+			permissionColor := color
+			if acl.Permission == "Deny" {
+				permissionColor = tcell.ColorRed
+			}
+			table.
+				SetCell(c+1, 0, &tview.TableCell{Text: acl.Principal, Align: tview.AlignLeft, Color: color}).
+				SetCell(c+1, 1, &tview.TableCell{Text: acl.Host, Align: tview.AlignCenter, Color: color}).
+				SetCell(c+1, 2, &tview.TableCell{Text: acl.Operation, Align: tview.AlignCenter, Color: color}).
+				SetCell(c+1, 3, &tview.TableCell{Text: acl.Permission, Align: tview.AlignCenter, Color: permissionColor}).
+				SetCell(c+1, 4, &tview.TableCell{Text: acl.PatternType, Align: tview.AlignCenter, Color: color}).
+				SetCell(c+1, 5, &tview.TableCell{Text: acl.ResourceName, Align: tview.AlignLeft, Color: color})
+		}
+		main = table
+	}
+
+	capture := func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 'q':
+			ctrl.uic.app.Stop()
+			os.Exit(0)
 		case 't':
+			ctrl.uic.grid.RemoveItem(main)
 			go topicInfoPage(ctrl, topicName, topicDetail)
+		case 'z':
+			ctrl.uic.grid.RemoveItem(main)
+			go topicAclsPage(ctrl, topicName, topicDetail)
 		case 'l':
+			ctrl.uic.grid.RemoveItem(main)
 			go topicsPage(ctrl)
 		case 'm':
+			ctrl.uic.grid.RemoveItem(main)
 			go infoPage(ctrl)
+		}
+
+		return event
+	}
+
+	update(ctrl, main, capture)
+}
+
+// topicSchemasPage shows the schema registry subjects used for the keys and values of a topic
+func topicSchemasPage(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail) {
+	start := time.Now()
+	ctrl.uic.commandArea.SetText(fmt.Sprintf("t:Topic %s, l:List Topics, z:Refresh Page, m:Info, q:Quit", topicName))
+
+	var main tview.Primitive
+	if ctrl.env.registry == nil {
+		main = tview.NewTextView().SetText(fmt.Sprintf("No schema registry configured for environment %s (add schema_registry_url to jokk.toml)", ctrl.env.args.Environment))
+	} else {
+		table := tview.NewTable().
+			SetSelectable(false, false).
+			SetFixed(1, 7).
+			SetBordersColor(tcell.ColorYellow)
+		headers := []string{
+			"SUBJECT",
+			"VERSIONS",
+			"COMPATIBILITY",
+			"LATEST VERSION",
+			"SCHEMA ID",
+			"TYPE",
+			"REFERENCES",
+		}
+		for index, name := range headers {
+			table.SetCell(0, index, &tview.TableCell{Text: name, Align: tview.AlignCenter, Color: tcell.ColorYellow})
+		}
+
+		schemas := ""
+		for c, subject := range []string{topicName + "-key", topicName + "-value"} {
+			row := c + 1
+			table.SetCell(row, 0, &tview.TableCell{Text: subject, Align: tview.AlignLeft, Color: tcell.ColorWhite})
+			exists, err := ctrl.env.registry.SubjectExists(subject)
+			if err == nil && !exists {
+				table.SetCell(row, 1, &tview.TableCell{Text: "not registered", Align: tview.AlignCenter, Color: tcell.ColorGray})
+				continue
+			}
+			info, err := ctrl.env.registry.SubjectInfo(subject)
+			if err == nil && info.Latest == nil {
+				err = fmt.Errorf("no schema found")
+			}
+			if err != nil {
+				table.SetCell(row, 1, &tview.TableCell{Text: err.Error(), Align: tview.AlignLeft, Color: tcell.ColorRed})
+				continue
+			}
+			references := []string{}
+			for _, r := range info.Latest.References {
+				references = append(references, fmt.Sprintf("%s (%s v%d)", r.Name, r.Subject, r.Version))
+			}
+			table.
+				SetCell(row, 1, &tview.TableCell{Text: fmt.Sprintf("%v", info.Versions), Align: tview.AlignCenter, Color: tcell.ColorWhite}).
+				SetCell(row, 2, &tview.TableCell{Text: info.Compatibility, Align: tview.AlignCenter, Color: tcell.ColorWhite}).
+				SetCell(row, 3, &tview.TableCell{Text: fmt.Sprintf("%d", info.Latest.Version), Align: tview.AlignCenter, Color: tcell.ColorWhite}).
+				SetCell(row, 4, &tview.TableCell{Text: fmt.Sprintf("%d", info.Latest.Id), Align: tview.AlignCenter, Color: tcell.ColorWhite}).
+				SetCell(row, 5, &tview.TableCell{Text: info.Latest.SchemaType, Align: tview.AlignCenter, Color: tcell.ColorWhite}).
+				SetCell(row, 6, &tview.TableCell{Text: strings.Join(references, ", "), Align: tview.AlignLeft, Color: tcell.ColorWhite})
+			schemas = fmt.Sprintf("%s%s (version %d):\n%s\n\n", schemas, subject, info.Latest.Version, info.Latest.Schema)
+		}
+
+		main = tview.NewFlex().
+			SetDirection(tview.FlexRow).
+			AddItem(table, 4, 0, false).
+			AddItem(tview.NewTextView().SetText(schemas), 0, 1, false)
+	}
+	ctrl.uic.infoArea.SetText(fmt.Sprintf("%s\n\nSchemas for topic %s retrieved in %dms @ %s", infoText(&ctrl.env), topicName, time.Since(start).Milliseconds(), start.Format(time.RFC3339)))
+
+	capture := func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
 		case 'q':
 			ctrl.uic.app.Stop()
 			os.Exit(0)
+		case 't':
+			ctrl.uic.grid.RemoveItem(main)
+			go topicInfoPage(ctrl, topicName, topicDetail)
+		case 'z':
+			ctrl.uic.grid.RemoveItem(main)
+			go topicSchemasPage(ctrl, topicName, topicDetail)
+		case 'l':
+			ctrl.uic.grid.RemoveItem(main)
+			go topicsPage(ctrl)
+		case 'm':
+			ctrl.uic.grid.RemoveItem(main)
+			go infoPage(ctrl)
 		}
 
 		return event
 	}
 
-	text := tview.NewTextView().SetText("Retrieving first message...")
-	update(ctrl, text, capture)
+	update(ctrl, main, capture)
+}
+
+func pageViewMessages(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDetail) {
+	commandText := fmt.Sprintf("PgUp/PgDn:Page, Home/End:First/Last Page, ←/→:Partition, o:Offset, j:Time, h:Header Filter, Enter:Details, Esc:Close Details, w:Write Value to File, z:Refresh, t:Topic %s, l:List Topics, m:Info, q:Quit", topicName)
+	ctrl.uic.commandArea.SetText(commandText)
+	text := tview.NewTextView().SetText("Retrieving messages...")
+	update(ctrl, text, nil)
+
+	start, _, _ := parseTime(ctrl.env.logger, ctrl.env.args.StartTime, "")
+	if ctrl.env.args.StartTime == "" {
+		start = time.Time{}
+	}
+	browser, err := newMessageBrowser(ctrl.env.client, topicName, start)
+	if err != nil {
+		text.SetText(fmt.Sprintf("Cannot read topic %s: %v\n\nPress t to go back to the topic", topicName, err))
+		update(ctrl, text, func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Rune() == 't' {
+				go topicInfoPage(ctrl, topicName, topicDetail)
+			}
+			return event
+		})
+		return
+	}
+	headerFilters, _ := parseHeaderFilters(ctrl.env.args.HeaderFilter)
+
+	// the consumed messages do not tell how their timestamps were set so the topic config is used
+	timestampType, err := kafka.TopicConfigValue(ctrl.env.admin, topicName, "message.timestamp.type")
+	if err != nil {
+		timestampType = "unknown"
+	}
 
-	msgs := []MsgInfo{}
 	headers := []string{
-		"#",
 		"TIME",
+		"PARTITION",
 		"OFFSET",
+		"KEY",
+		"HEADERS",
 		"VALUE",
 	}
+	msgs := []sarama.ConsumerMessage{}
+	status := ""
+	// Start at row one for selection highlight
+	selectedRow := 1
+	// the message shown in the detail pane (nil when the pane is closed)
+	var detailMsg *sarama.ConsumerMessage
+	var main tview.Primitive
+	var capture func(event *tcell.EventKey) *tcell.EventKey
 
-	createTable := func(msg MsgInfo) *tview.Table {
-		msgs = append(msgs, MsgInfo{
-			timestamp: msg.timestamp,
-			offset:    msg.offset,
-			value:     string(msg.value),
-		})
-
+	render := func() {
 		table := tview.NewTable().
 			SetSelectable(false, false).
-			SetFixed(1, 4).
+			SetFixed(1, len(headers)).
 			SetBordersColor(tcell.ColorYellow)
 
 		// headers
@@ -509,12 +824,6 @@ func pageViewMessages(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDeta
 			table.SetCell(0, index, &tview.TableCell{Text: name, Align: tview.AlignCenter, Color: tcell.ColorYellow})
 		}
 
-		// order msgs based on decending time
-		sort.Slice(msgs, func(i, j int) bool {
-			return msgs[i].timestamp.After(msgs[j].timestamp)
-		})
-
-		counter := len(msgs)
 		var color tcell.Color
 		for c, msg := range msgs {
 			if c%2 != 0 {
@@ -523,37 +832,341 @@ func pageViewMessages(ctrl *Ctrl, topicName string, topicDetail sarama.TopicDeta
 				color = tcell.ColorWhite
 			}
 			table.
-				SetCell(c+1, 0, &tview.TableCell{Text: strconv.Itoa(int(counter)), Align: tview.AlignLeft, Color: color}).
-				SetCell(c+1, 1, &tview.TableCell{Text: fmt.Sprintf("%v", msg.timestamp), Align: tview.AlignLeft, Color: color}).
-				SetCell(c+1, 2, &tview.TableCell{Text: fmt.Sprintf("%d", msg.offset), Align: tview.AlignCenter, Color: color}).
-				SetCell(c+1, 3, &tview.TableCell{Text: fmt.Sprintf("%v", msg.value), Align: tview.AlignCenter, Color: color})
-			counter--
+				SetCell(c+1, 0, &tview.TableCell{Text: fmt.Sprintf("%v", msg.Timestamp), Align: tview.AlignLeft, Color: color}).
+				SetCell(c+1, 1, &tview.TableCell{Text: fmt.Sprintf("%d", msg.Partition), Align: tview.AlignCenter, Color: color}).
+				SetCell(c+1, 2, &tview.TableCell{Text: fmt.Sprintf("%d", msg.Offset), Align: tview.AlignCenter, Color: color}).
+				SetCell(c+1, 3, &tview.TableCell{Text: ctrl.env.decoders.keyText(msg), Align: tview.AlignLeft, Color: color, MaxWidth: 30}).
+				SetCell(c+1, 4, &tview.TableCell{Text: headersText(msg), Align: tview.AlignLeft, Color: color, MaxWidth: 40}).
+				SetCell(c+1, 5, &tview.TableCell{Text: ctrl.env.decoders.valueText(msg), Align: tview.AlignLeft, Color: color})
+		}
+		if selectedRow < table.GetRowCount() {
+			for column := range headers {
+				table.GetCell(selectedRow, column).SetBackgroundColor(tcell.ColorGreen)
+			}
+		}
+		// Calculate the number of visible lines to keep the highlighted row in view
+		_, _, _, totalHeight := ctrl.uic.mainArea.GetRect()
+		if detailMsg != nil {
+			totalHeight = totalHeight / 3
+		}
+		if selectedRow > totalHeight-1 {
+			table.SetOffset(selectedRow-totalHeight+1, 0)
 		}
 
-		return table
+		if detailMsg == nil {
+			main = table
+		} else {
+			detail := tview.NewTextView().
+				SetDynamicColors(true).
+				SetText(messageDetailText(ctrl.env.decoders, *detailMsg, timestampType))
+			detail.SetBorder(true).SetTitle(fmt.Sprintf("Message %d:%d", detailMsg.Partition, detailMsg.Offset)).SetTitleAlign(tview.AlignLeft)
+			main = tview.NewFlex().
+				SetDirection(tview.FlexRow).
+				AddItem(table, 0, 1, false).
+				AddItem(detail, 0, 2, false)
+		}
+		ctrl.uic.infoArea.SetText(fmt.Sprintf("%s\n\nTopic %s, %s", infoText(&ctrl.env), topicName, status))
+		// render runs on the UI goroutine, see layout
+		layout(ctrl, main, capture)
 	}
 
-	for {
-		select {
-		case msg := <-resultChan:
-			if msg.Topic == "" {
-				msgInfo := MsgInfo{
-					timestamp: time.Now(),
-					offset:    -1,
-					value:     "No more messages found",
+	/*
+	 * The browser reads from Kafka in the background while the page state (msgs, status, selectedRow, detailMsg,
+	 * headerFilters) belongs to the UI goroutine. Loads are run one at a time under loading, and their result is
+	 * applied and drawn on the UI goroutine only if no newer load was requested in the meantime.
+	 */
+	var loading sync.Mutex
+	var generation atomic.Int64
+	closed := false
+	partition := browser.currentPartition()
+
+	// load moves the browser and shows the messages of the new page that match the header filter and --value-match
+	load := func(move func() error) {
+		current := generation.Add(1)
+		filters := headerFilters
+		go func() {
+			loading.Lock()
+			defer loading.Unlock()
+			if closed {
+				return
+			}
+			var result []sarama.ConsumerMessage
+			var position string
+			var err error
+			if move != nil {
+				err = move()
+			}
+			var page messagePage
+			if err == nil {
+				page, err = browser.page()
+			}
+			if err == nil {
+				result = []sarama.ConsumerMessage{}
+				for _, msg := range page.messages {
+					if messageMatches(ctrl.env.decoders, msg, filters, ctrl.env.args.ValueMatch) {
+						result = append(result, msg)
+					}
+				}
+				position = browser.position(page)
+				if len(result) < len(page.messages) {
+					position = fmt.Sprintf("%s (%d of %d messages match the filters)", position, len(result), len(page.messages))
+				}
+			}
+			loadedPartition := browser.currentPartition()
+
+			ctrl.uic.app.QueueUpdateDraw(func() {
+				if generation.Load() != current {
+					return
 				}
-				ctrl.uic.commandArea.SetText(fmt.Sprintf("t:Topic %s, l:List Topics, m:Info, q:Quit", topicName))
-				update(ctrl, createTable(msgInfo), capture)
-			} else {
-				msgInfo := MsgInfo{
-					timestamp: msg.Timestamp,
-					offset:    msg.Offset,
-					value:     string(msg.Value),
+				partition = loadedPartition
+				if err != nil {
+					status = fmt.Sprintf("error: %v", err)
+				} else {
+					msgs = result
+					status = position
+					selectedRow = 1
+					detailMsg = nil
+				}
+				render()
+			})
+		}()
+	}
+
+	// jumpForm asks for an offset or a time to move the current partition to
+	jumpForm := func(label string, value string, jump func(string) error) {
+		ctrl.uic.grid.RemoveItem(main)
+		form := tview.NewForm()
+		form.
+			AddInputField(label, value, 40, nil, nil).
+			AddButton("Go", func() {
+				input := form.GetFormItem(0).(*tview.InputField).GetText()
+				load(func() error { return jump(input) })
+			}).
+			AddButton("Cancel", func() {
+				render()
+			})
+		form.SetBorder(true).SetTitle(fmt.Sprintf("Partition %d", partition)).SetTitleAlign(tview.AlignLeft)
+		ctrl.uic.app.SetRoot(form, true).SetFocus(form)
+	}
+
+	// leave drops the results of pending loads and closes the browser once the current load is done
+	leave := func(page func()) {
+		generation.Add(1)
+		go func() {
+			loading.Lock()
+			closed = true
+			browser.close()
+			loading.Unlock()
+			page()
+		}()
+	}
+
+	capture = func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyDown:
+			if selectedRow < len(msgs) {
+				selectedRow++
+				render()
+			}
+		case tcell.KeyUp:
+			if selectedRow > 1 {
+				selectedRow--
+				render()
+			}
+		case tcell.KeyPgDn:
+			load(browser.nextPage)
+		case tcell.KeyPgUp:
+			load(browser.previousPage)
+		case tcell.KeyHome:
+			load(browser.firstPage)
+		case tcell.KeyEnd:
+			load(browser.lastPage)
+		case tcell.KeyRight:
+			load(func() error { browser.switchPartition(1); return nil })
+		case tcell.KeyLeft:
+			load(func() error { browser.switchPartition(-1); return nil })
+		case tcell.KeyEnter:
+			if selectedRow <= len(msgs) {
+				msg := msgs[selectedRow-1]
+				detailMsg = &msg
+				render()
+			}
+		case tcell.KeyEscape:
+			detailMsg = nil
+			render()
+		}
+
+		switch event.Rune() {
+		case 'o': // jump to offset
+			jumpForm("Offset", "", func(input string) error {
+				offset, err := strconv.ParseInt(input, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid offset %s", input)
+				}
+				return browser.jumpToOffset(offset)
+			})
+		case 'j': // jump to time
+			jumpForm("Time (YYYY-MM-DD HH:MM:SS)", time.Now().Format("2006-01-02 15:04:05"), func(input string) error {
+				t, err := time.ParseInLocation("2006-01-02 15:04:05", input, time.Local)
+				if err != nil {
+					return fmt.Errorf("invalid time %s", input)
+				}
+				return browser.jumpToTime(t)
+			})
+		case 'h': // filter the messages on header values
+			current := []string{}
+			for name, value := range headerFilters {
+				current = append(current, fmt.Sprintf("%s=%s", name, value))
+			}
+			sort.Strings(current)
+			ctrl.uic.grid.RemoveItem(main)
+			form := tview.NewForm()
+			form.
+				AddInputField("Header filter (name=value, comma separated)", strings.Join(current, ","), 60, nil, nil).
+				AddButton("Apply", func() {
+					filters, err := parseHeaderFilters(splitPatterns(form.GetFormItem(0).(*tview.InputField).GetText()))
+					if err != nil {
+						form.SetTitle(fmt.Sprintf("Header filter - %v", err))
+						return
+					}
+					headerFilters = filters
+					load(nil)
+				}).
+				AddButton("Cancel", func() {
+					render()
+				})
+			form.SetBorder(true).SetTitle("Header filter").SetTitleAlign(tview.AlignLeft)
+			ctrl.uic.app.SetRoot(form, true).SetFocus(form)
+		case 'w': // write the value of the selected message to a file
+			if selectedRow > len(msgs) {
+				break
+			}
+			msg := msgs[selectedRow-1]
+			value, extension := messageValueFile(ctrl.env.decoders, msg)
+			ctrl.uic.grid.RemoveItem(main)
+			form := tview.NewForm()
+			form.
+				AddInputField("Write value to file", fmt.Sprintf("%s_%d_%d.%s", topicName, msg.Partition, msg.Offset, extension), 75, nil, nil).
+				AddButton("Save", func() {
+					fileName := form.GetFormItem(0).(*tview.InputField).GetText()
+					if err := os.WriteFile(fileName, value, 0644); err != nil {
+						form.SetTitle(fmt.Sprintf("Write value - %v", err))
+						return
+					}
+					status = fmt.Sprintf("value of message %d:%d written to %s", msg.Partition, msg.Offset, fileName)
+					render()
+				}).
+				AddButton("Cancel", func() {
+					render()
+				})
+			form.SetBorder(true).SetTitle("Write value").SetTitleAlign(tview.AlignLeft)
+			ctrl.uic.app.SetRoot(form, true).SetFocus(form)
+		case 'z': // refresh to see new messages
+			load(func() error { browser.refresh(); return nil })
+		case 't':
+			leave(func() { topicInfoPage(ctrl, topicName, topicDetail) })
+		case 'l':
+			leave(func() { topicsPage(ctrl) })
+		case 'm':
+			leave(func() { infoPage(ctrl) })
+		case 'q':
+			ctrl.uic.app.Stop()
+			os.Exit(0)
+		}
+
+		return event
+	}
+
+	load(nil)
+}
+
+// messageDetailText describes a message with tview color tags - the value is shown as JSON if possible and as a hex dump otherwise
+func messageDetailText(decoders messageDecoders, msg sarama.ConsumerMessage, timestampType string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[yellow]Partition:[-]      %d\n", msg.Partition)
+	fmt.Fprintf(&b, "[yellow]Offset:[-]         %d\n", msg.Offset)
+	fmt.Fprintf(&b, "[yellow]Timestamp:[-]      %v\n", msg.Timestamp)
+	fmt.Fprintf(&b, "[yellow]Timestamp type:[-] %s\n", timestampType)
+	fmt.Fprintf(&b, "[yellow]Key:[-]            %s\n", escapeTags(decoders.keyText(msg), "-"))
+	b.WriteString("[yellow]Headers:[-]")
+	if len(msg.Headers) == 0 {
+		b.WriteString("        -")
+	}
+	for _, h := range msg.Headers {
+		fmt.Fprintf(&b, "\n  %s = %s", escapeTags(string(h.Key), "-"), escapeTags(string(h.Value), "-"))
+	}
+
+	if len(msg.Value) == 0 {
+		b.WriteString("\n\n[yellow]Value:[-] - (empty/tombstone)")
+	} else if pretty, ok := prettyJson(decoders.valueText(msg)); ok {
+		b.WriteString("\n\n[yellow]Value (JSON):[-]\n")
+		b.WriteString(highlightJson(pretty))
+	} else {
+		fmt.Fprintf(&b, "\n\n[yellow]Value (%d bytes):[-]\n", len(msg.Value))
+		b.WriteString(escapeTags(hex.Dump(msg.Value), "-"))
+	}
+	return b.String()
+}
+
+// messageValueFile returns what to write when a value is saved: indented JSON when the decoded value is JSON, the raw bytes otherwise
+func messageValueFile(decoders messageDecoders, msg sarama.ConsumerMessage) ([]byte, string) {
+	if pretty, ok := prettyJson(decoders.valueText(msg)); ok {
+		return []byte(pretty), "json"
+	}
+	return msg.Value, "bin"
+}
+
+func prettyJson(s string) (string, bool) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(s), "", "  "); err != nil {
+		return "", false
+	}
+	return indented.String(), true
+}
+
+/*
+ * A '[' directly followed by a color tag is shown as it is, which is used to escape text that would otherwise be
+ * taken for a tag (tview.Escape does not handle e.g. "[]"). The color is the one the text should continue with.
+ */
+func escapeTags(text string, color string) string {
+	return strings.ReplaceAll(text, "[", "[["+color+"]")
+}
+
+// highlightJson adds color tags to indented JSON: keys are yellow, strings green and other values light blue
+func highlightJson(s string) string {
+	const punctuation = "{}[],: \n"
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
 				}
-				update(ctrl, createTable(msgInfo), capture)
+				end++
+			}
+			end = min(end+1, len(s))
+			color := "green"
+			if strings.HasPrefix(s[end:], ":") {
+				color = "yellow"
+			}
+			fmt.Fprintf(&b, "[%s]%s", color, escapeTags(s[i:end], color))
+			i = end
+		case strings.IndexByte(punctuation, s[i]) >= 0:
+			fmt.Fprintf(&b, "[-]%s", escapeTags(s[i:i+1], "-"))
+			i++
+		default: // numbers, true, false and null
+			end := i
+			for end < len(s) && strings.IndexByte(punctuation, s[end]) < 0 {
+				end++
 			}
+			fmt.Fprintf(&b, "[aqua]%s", s[i:end])
+			i = end
 		}
 	}
+	b.WriteString("[-]")
+	return b.String()
 }
 
 func infoPage(ctrl *Ctrl) {
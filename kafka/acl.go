@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+type AclInfo struct {
+	ResourceType string
+	ResourceName string
+	PatternType  string
+	Principal    string
+	Host         string
+	Operation    string
+	Permission   string
+}
+
+// AclSpec holds the textual (command line) representation of an ACL or an ACL filter
+type AclSpec struct {
+	ResourceType string
+	ResourceName string
+	PatternType  string
+	Principal    string
+	Host         string
+	Operation    string
+	Permission   string
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Filter converts the spec into an ACL filter - values that are not set match anything
+func (s AclSpec) Filter() (sarama.AclFilter, error) {
+	filter := sarama.AclFilter{
+		ResourceName: optionalString(s.ResourceName),
+		Principal:    optionalString(s.Principal),
+		Host:         optionalString(s.Host),
+	}
+	if err := filter.ResourceType.UnmarshalText([]byte(valueOrDefault(s.ResourceType, "any"))); err != nil {
+		return filter, err
+	}
+	if err := filter.ResourcePatternTypeFilter.UnmarshalText([]byte(valueOrDefault(s.PatternType, "any"))); err != nil {
+		return filter, err
+	}
+	if err := filter.Operation.UnmarshalText([]byte(valueOrDefault(s.Operation, "any"))); err != nil {
+		return filter, err
+	}
+	if err := filter.PermissionType.UnmarshalText([]byte(valueOrDefault(s.Permission, "any"))); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// Binding converts the spec into a resource and an ACL that can be created
+func (s AclSpec) Binding() (sarama.Resource, sarama.Acl, error) {
+	resource := sarama.Resource{ResourceName: s.ResourceName}
+	acl := sarama.Acl{
+		Principal: s.Principal,
+		Host:      valueOrDefault(s.Host, "*"),
+	}
+	if s.ResourceType == "" || s.ResourceName == "" || s.Principal == "" || s.Operation == "" {
+		return resource, acl, fmt.Errorf("resource type, resource name, principal and operation are required to create an ACL")
+	}
+	if err := resource.ResourceType.UnmarshalText([]byte(s.ResourceType)); err != nil {
+		return resource, acl, err
+	}
+	if err := resource.ResourcePatternType.UnmarshalText([]byte(valueOrDefault(s.PatternType, "literal"))); err != nil {
+		return resource, acl, err
+	}
+	if err := acl.Operation.UnmarshalText([]byte(s.Operation)); err != nil {
+		return resource, acl, err
+	}
+	if err := acl.PermissionType.UnmarshalText([]byte(valueOrDefault(s.Permission, "allow"))); err != nil {
+		return resource, acl, err
+	}
+	return resource, acl, nil
+}
+
+func toAclInfo(resource sarama.Resource, acl sarama.Acl) AclInfo {
+	return AclInfo{
+		ResourceType: resource.ResourceType.String(),
+		ResourceName: resource.ResourceName,
+		PatternType:  resource.ResourcePatternType.String(),
+		Principal:    acl.Principal,
+		Host:         acl.Host,
+		Operation:    acl.Operation.String(),
+		Permission:   acl.PermissionType.String(),
+	}
+}
+
+func sortAcls(acls []AclInfo) {
+	sort.Slice(acls, func(i, j int) bool {
+		if acls[i].ResourceType != acls[j].ResourceType {
+			return acls[i].ResourceType < acls[j].ResourceType
+		}
+		if acls[i].ResourceName != acls[j].ResourceName {
+			return acls[i].ResourceName < acls[j].ResourceName
+		}
+		return acls[i].Principal < acls[j].Principal
+	})
+}
+
+func ListAcls(admin sarama.ClusterAdmin, filter sarama.AclFilter) ([]AclInfo, error) {
+	resourceAcls, err := admin.ListAcls(filter)
+	if err != nil {
+		return nil, err
+	}
+	acls := []AclInfo{}
+	for _, ra := range resourceAcls {
+		for _, acl := range ra.Acls {
+			acls = append(acls, toAclInfo(ra.Resource, *acl))
+		}
+	}
+	sortAcls(acls)
+	return acls, nil
+}
+
+// TopicAcls returns the ACLs that apply to a topic, i.e. literal, prefixed and wildcard ACLs
+func TopicAcls(admin sarama.ClusterAdmin, topic string) ([]AclInfo, error) {
+	return ListAcls(admin, sarama.AclFilter{
+		ResourceType:              sarama.AclResourceTopic,
+		ResourceName:              &topic,
+		ResourcePatternTypeFilter: sarama.AclPatternMatch,
+		Operation:                 sarama.AclOperationAny,
+		PermissionType:            sarama.AclPermissionAny,
+	})
+}
+
+func CreateAcl(admin sarama.ClusterAdmin, spec AclSpec) (AclInfo, error) {
+	resource, acl, err := spec.Binding()
+	if err != nil {
+		return AclInfo{}, err
+	}
+	return toAclInfo(resource, acl), admin.CreateACL(resource, acl)
+}
+
+func DeleteAcls(admin sarama.ClusterAdmin, filter sarama.AclFilter) ([]AclInfo, error) {
+	matchingAcls, err := admin.DeleteACL(filter, false)
+	if err != nil {
+		return nil, err
+	}
+	acls := []AclInfo{}
+	for _, ma := range matchingAcls {
+		if ma.Err != sarama.ErrNoError {
+			return acls, fmt.Errorf("could not delete ACL for %s: %v", ma.Principal, ma.Err)
+		}
+		acls = append(acls, toAclInfo(ma.Resource, ma.Acl))
+	}
+	sortAcls(acls)
+	return acls, nil
+}
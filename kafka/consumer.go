@@ -6,19 +6,31 @@ import (
 	"os"
 	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	"github.com/henrikengstrom/jokk/common"
 )
 
 type JokkConsumer struct {
 	logger     common.Logger
 	consumer   sarama.ConsumerGroup
-	topicChan  chan string
+	topicChan  chan consumeRequest
 	MsgChannel chan sarama.ConsumerMessage
+	// startOffsets are the offsets to start the partitions of the next session at (set by StartReceivingMessagesFrom)
+	startOffsets map[int32]int64
+}
+
+type consumeRequest struct {
+	topic   string
+	offsets map[int32]int64
 }
 
 func (jc *JokkConsumer) StartReceivingMessages(topic string) {
-	jc.topicChan <- topic
+	jc.topicChan <- consumeRequest{topic: topic}
+}
+
+// StartReceivingMessagesFrom starts the partitions in offsets at the given offset (e.g. to resume an earlier run) and the others at the oldest offset
+func (jc *JokkConsumer) StartReceivingMessagesFrom(topic string, offsets map[int32]int64) {
+	jc.topicChan <- consumeRequest{topic: topic, offsets: offsets}
 }
 
 func (jc *JokkConsumer) Cleanup(session sarama.ConsumerGroupSession) error {
@@ -34,6 +46,17 @@ func (jc *JokkConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 }
 
 func (jc *JokkConsumer) Setup(session sarama.ConsumerGroupSession) (err error) {
+	for topic, partitions := range session.Claims() {
+		for _, p := range partitions {
+			if offset, ok := jc.startOffsets[p]; ok {
+				// MarkOffset only moves the offset forward and ResetOffset only backwards
+				session.MarkOffset(topic, p, offset, "")
+				session.ResetOffset(topic, p, offset, "")
+			}
+		}
+	}
+	// a new session after a rebalance continues from the committed offsets
+	jc.startOffsets = nil
 	return nil
 }
 
@@ -50,7 +73,7 @@ func NewConsumer(log common.Logger, host string, conf *sarama.Config) (JokkConsu
 	jc := JokkConsumer{
 		logger:     log,
 		consumer:   cg,
-		topicChan:  make(chan string),
+		topicChan:  make(chan consumeRequest),
 		MsgChannel: make(chan sarama.ConsumerMessage),
 	}
 
@@ -58,10 +81,11 @@ func NewConsumer(log common.Logger, host string, conf *sarama.Config) (JokkConsu
 	go func() {
 		for {
 			// park this until we know what topics to use (set in ReceiveMessage)
-			topic := <-jc.topicChan
-			topics := []string{topic}
+			request := <-jc.topicChan
+			jc.startOffsets = request.offsets
+			topics := []string{request.topic}
 			if err := jc.consumer.Consume(ctx, topics, &jc); err != nil {
-				log.Errorf("error consuming message from kafka on topic %s - %v", topic, err)
+				log.Errorf("error consuming message from kafka on topic %s - %v", request.topic, err)
 				os.Exit(1)
 			}
 		}
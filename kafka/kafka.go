@@ -2,12 +2,13 @@ package kafka
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
 	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	"github.com/henrikengstrom/jokk/common"
 )
 
@@ -55,6 +56,14 @@ type TopicDetailInfo struct {
 	PartionDetailedInfo []PartitionDetailInfo
 }
 
+// requireVersion explains the error sarama returns when the configured Kafka version is older than a request needs
+func requireVersion(err error, feature string, version string) error {
+	if errors.Is(err, sarama.ErrUnsupportedVersion) {
+		return fmt.Errorf("%s needs Kafka %s or later (set kafka_version of the environment accordingly): %w", feature, version, err)
+	}
+	return err
+}
+
 func DefaultConsumerConfig(clientId string, kafkaVersion sarama.KafkaVersion) *sarama.Config {
 	conf := sarama.NewConfig()
 	conf.Version = kafkaVersion
@@ -103,8 +112,14 @@ func EnableSasl(
 	switch algorithm {
 	case "plain":
 		conf.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case "sha256":
+		conf.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		conf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA256} }
+	case "sha512":
+		conf.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		conf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
 	default:
-		return nil, fmt.Errorf("invalid SHA algorithm %s: can be either 'sha256' or 'sha512'", algorithm)
+		return nil, fmt.Errorf("invalid SASL algorithm %s: can be either 'plain', 'sha256' or 'sha512'", algorithm)
 	}
 	conf.Net.TLS.Enable = useTLS
 	conf.Net.TLS.Config = &tls.Config{
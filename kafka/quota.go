@@ -0,0 +1,130 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	ProducerByteRate  = "producer_byte_rate"
+	ConsumerByteRate  = "consumer_byte_rate"
+	RequestPercentage = "request_percentage"
+
+	// DefaultQuotaEntity is used instead of a name to refer to the default quota of an entity type
+	DefaultQuotaEntity = "<default>"
+)
+
+type QuotaInfo struct {
+	Entity string
+	Values map[string]float64
+}
+
+// QuotaEntitySpec identifies the entity of a quota - empty values are not part of the entity
+type QuotaEntitySpec struct {
+	User     string
+	ClientId string
+	Ip       string
+}
+
+func (s QuotaEntitySpec) parts() map[sarama.QuotaEntityType]string {
+	parts := make(map[sarama.QuotaEntityType]string)
+	if s.User != "" {
+		parts[sarama.QuotaEntityUser] = s.User
+	}
+	if s.ClientId != "" {
+		parts[sarama.QuotaEntityClientID] = s.ClientId
+	}
+	if s.Ip != "" {
+		parts[sarama.QuotaEntityIP] = s.Ip
+	}
+	return parts
+}
+
+func (s QuotaEntitySpec) IsEmpty() bool {
+	return len(s.parts()) == 0
+}
+
+func (s QuotaEntitySpec) components() []sarama.QuotaEntityComponent {
+	components := []sarama.QuotaEntityComponent{}
+	for entityType, name := range s.parts() {
+		component := sarama.QuotaEntityComponent{EntityType: entityType, MatchType: sarama.QuotaMatchExact, Name: name}
+		if name == DefaultQuotaEntity {
+			component.MatchType = sarama.QuotaMatchDefault
+			component.Name = ""
+		}
+		components = append(components, component)
+	}
+	return components
+}
+
+func (s QuotaEntitySpec) filter() []sarama.QuotaFilterComponent {
+	filter := []sarama.QuotaFilterComponent{}
+	for _, c := range s.components() {
+		filter = append(filter, sarama.QuotaFilterComponent{EntityType: c.EntityType, MatchType: c.MatchType, Match: c.Name})
+	}
+	return filter
+}
+
+func entityName(entity []sarama.QuotaEntityComponent) string {
+	parts := []string{}
+	for _, c := range entity {
+		name := c.Name
+		if c.MatchType == sarama.QuotaMatchDefault {
+			name = DefaultQuotaEntity
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", c.EntityType, name))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// DescribeQuotas returns the quotas matching the entity (all quotas if the entity is empty)
+func DescribeQuotas(admin sarama.ClusterAdmin, spec QuotaEntitySpec) ([]QuotaInfo, error) {
+	entries, err := admin.DescribeClientQuotas(spec.filter(), false)
+	if err != nil {
+		return nil, requireVersion(err, "Describing quotas", "2.6")
+	}
+
+	quotas := []QuotaInfo{}
+	for _, e := range entries {
+		quotas = append(quotas, QuotaInfo{
+			Entity: entityName(e.Entity),
+			Values: e.Values,
+		})
+	}
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].Entity < quotas[j].Entity
+	})
+	return quotas, nil
+}
+
+// AlterQuotas applies the quota changes of an entity in one request, so the brokers apply either all or none of them
+func AlterQuotas(admin sarama.ClusterAdmin, spec QuotaEntitySpec, ops []sarama.ClientQuotasOp, validateOnly bool) error {
+	if spec.IsEmpty() {
+		return fmt.Errorf("a user, client-id or ip entity is required to alter a quota")
+	}
+	// sarama's AlterClientQuotas only sends a single change
+	controller, err := admin.Controller()
+	if err != nil {
+		return err
+	}
+	response, err := controller.AlterClientQuotas(&sarama.AlterClientQuotasRequest{
+		Entries:      []sarama.AlterClientQuotasEntry{{Entity: spec.components(), Ops: ops}},
+		ValidateOnly: validateOnly,
+	})
+	if err != nil {
+		return requireVersion(err, "Altering quotas", "2.6")
+	}
+	for _, entry := range response.Entries {
+		if entry.ErrorMsg != nil && *entry.ErrorMsg != "" {
+			return fmt.Errorf("%v: %s", entry.ErrorCode, *entry.ErrorMsg)
+		}
+		if entry.ErrorCode != sarama.ErrNoError {
+			return entry.ErrorCode
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// PartitionReader reads ranges of messages from the partitions of a topic without joining a consumer group
+type PartitionReader struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	topic    string
+	// Timeout is the longest time to wait for messages that are expected (e.g. offsets taken by transaction markers never arrive)
+	Timeout time.Duration
+}
+
+func NewPartitionReader(client sarama.Client, topic string) (*PartitionReader, error) {
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return &PartitionReader{client: client, consumer: consumer, topic: topic, Timeout: 5 * time.Second}, nil
+}
+
+func (r *PartitionReader) Topic() string {
+	return r.topic
+}
+
+func (r *PartitionReader) Partitions() ([]int32, error) {
+	return r.client.Partitions(r.topic)
+}
+
+// OffsetRange returns the oldest offset and the high water mark (the offset the next message will get) of a partition
+func (r *PartitionReader) OffsetRange(partition int32) (int64, int64, error) {
+	oldest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, err
+	}
+	newest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, err
+	}
+	return oldest, newest, nil
+}
+
+// OffsetForTime returns the offset of the first message at or after the time (the high water mark if there is none)
+func (r *PartitionReader) OffsetForTime(partition int32, t time.Time) (int64, error) {
+	offset, err := r.client.GetOffset(r.topic, partition, t.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return r.client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+	}
+	return offset, nil
+}
+
+// Read returns up to count messages of a partition starting at offset (or the oldest offset if it has been deleted)
+func (r *PartitionReader) Read(partition int32, offset int64, count int) ([]sarama.ConsumerMessage, error) {
+	oldest, newest, err := r.OffsetRange(partition)
+	if err != nil {
+		return nil, err
+	}
+	if offset < oldest {
+		offset = oldest
+	}
+	messages := []sarama.ConsumerMessage{}
+	if offset >= newest || count <= 0 {
+		return messages, nil
+	}
+
+	pc, err := r.consumer.ConsumePartition(r.topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+
+	timeout := time.NewTimer(r.Timeout)
+	defer timeout.Stop()
+	for len(messages) < count {
+		select {
+		case msg := <-pc.Messages():
+			messages = append(messages, *msg)
+			if msg.Offset+1 >= newest {
+				return messages, nil
+			}
+		case err := <-pc.Errors():
+			return messages, fmt.Errorf("cannot read partition %d of topic %s: %v", partition, r.topic, err.Err)
+		case <-timeout.C:
+			return messages, nil
+		}
+	}
+	return messages, nil
+}
+
+// ReadRetries is how many reads in a row may return nothing before ReadRange gives up
+const ReadRetries = 3
+
+/*
+ * ReadRange calls fn for every message of a partition from offset up to (not including) end and returns the offset it
+ * got to. A read that returns nothing is tried again unless the remaining offsets only hold transaction markers, so the
+ * returned offset is only below end when no messages arrived in ReadRetries reads in a row (or fn failed).
+ */
+func (r *PartitionReader) ReadRange(partition int32, offset int64, end int64, batchSize int, fn func(msg *sarama.ConsumerMessage) error) (int64, error) {
+	for retries := 0; offset < end && retries < ReadRetries; {
+		messages, err := r.Read(partition, offset, batchSize)
+		if err != nil {
+			return offset, err
+		}
+		if len(messages) == 0 {
+			// nothing arrived before the read timed out - either the remaining offsets are transaction markers that
+			// never show up as messages or the broker was slow, in which case the read is tried again
+			controlOnly, err := r.ControlRecordsOnly(partition, offset, end)
+			if err != nil {
+				return offset, err
+			}
+			if controlOnly {
+				return end, nil
+			}
+			retries++
+			continue
+		}
+		retries = 0
+		for i := range messages {
+			if messages[i].Offset >= end {
+				return end, nil
+			}
+			if err = fn(&messages[i]); err != nil {
+				return messages[i].Offset, err
+			}
+		}
+		offset = messages[len(messages)-1].Offset + 1
+	}
+	return offset, nil
+}
+
+func (r *PartitionReader) Close() error {
+	return r.consumer.Close()
+}
+
+// PartitionOffsets are the oldest offset and the high water mark of a partition
+type PartitionOffsets struct {
+	Oldest        int64
+	HighWaterMark int64
+}
+
+// TopicOffsets returns the oldest offset and the high water mark of every partition of a topic
+func TopicOffsets(client sarama.Client, topic string) (map[int32]PartitionOffsets, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	offsets := map[int32]PartitionOffsets{}
+	for _, p := range partitions {
+		oldest, err := client.GetOffset(topic, p, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := client.GetOffset(topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		offsets[p] = PartitionOffsets{Oldest: oldest, HighWaterMark: newest}
+	}
+	return offsets, nil
+}
+
+// controlFetchBytes is the most a fetch of record batches returns - plenty for the few bytes of transaction markers
+const controlFetchBytes = 1024 * 1024
+
+// controlWindow is how many offsets below the high water mark ReadEnd first looks for the last record that is not a transaction marker
+const controlWindow = 100
+
+// fetchBatches fetches the record batches of a partition from offset on from its leader, which shows control records
+func fetchBatches(client sarama.Client, topic string, partition int32, offset int64) ([]*sarama.RecordBatch, error) {
+	broker, err := client.Leader(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	// version 4 is the first with record batches (and with them control records)
+	request := &sarama.FetchRequest{Version: 4, MaxWaitTime: 100, MinBytes: 1, MaxBytes: controlFetchBytes, Isolation: sarama.ReadUncommitted}
+	request.AddBlock(topic, partition, offset, controlFetchBytes, -1)
+	response, err := broker.Fetch(request)
+	if err != nil {
+		return nil, err
+	}
+	block := response.GetBlock(topic, partition)
+	if block == nil {
+		return nil, fmt.Errorf("no fetch response for partition %d of topic %s", partition, topic)
+	}
+	if block.Err != sarama.ErrNoError {
+		return nil, block.Err
+	}
+	batches := []*sarama.RecordBatch{}
+	for _, records := range block.RecordsSet {
+		// messages in the format before Kafka 0.11 come as message sets, the batches up to them are returned
+		if records.RecordBatch == nil {
+			break
+		}
+		batches = append(batches, records.RecordBatch)
+	}
+	return batches, nil
+}
+
+func lastOffset(batch *sarama.RecordBatch) int64 {
+	return batch.FirstOffset + int64(batch.LastOffsetDelta)
+}
+
+/*
+ * ControlRecordsOnly tells whether the offsets from - to (exclusive) of a partition only hold control records, i.e. the
+ * commit and abort markers of transactions. Consumers never get these, so a read of the partition ends before its high
+ * water mark when they are the last offsets.
+ */
+func (r *PartitionReader) ControlRecordsOnly(partition int32, from int64, to int64) (bool, error) {
+	batches, err := fetchBatches(r.client, r.topic, partition, from)
+	if err != nil {
+		return false, err
+	}
+	next := from
+	for _, batch := range batches {
+		if lastOffset(batch) < next {
+			// the batch holding from starts before it
+			continue
+		}
+		if batch.FirstOffset >= to {
+			break
+		}
+		// a gap before the batch is offsets removed by compaction
+		if !batch.Control {
+			return false, nil
+		}
+		next = lastOffset(batch) + 1
+	}
+	return next >= to, nil
+}
+
+/*
+ * ReadEnd returns the offset after the last record of a partition a consumer gets, which is the high water mark unless
+ * the partition ends with the markers of transactions. It is the high water mark as well when the end of the partition
+ * cannot be fetched in one go, so it is never below the last record.
+ */
+func ReadEnd(client sarama.Client, topic string, partition int32, offsets PartitionOffsets) (int64, error) {
+	// the window below the high water mark is doubled until it holds a record that is not a marker
+	for window := int64(controlWindow); ; window *= 2 {
+		from := max(offsets.Oldest, offsets.HighWaterMark-window)
+		if from >= offsets.HighWaterMark {
+			return offsets.HighWaterMark, nil
+		}
+		batches, err := fetchBatches(client, topic, partition, from)
+		if err != nil {
+			return offsets.HighWaterMark, err
+		}
+		end := int64(-1)
+		covered := from
+		for _, batch := range batches {
+			if batch.FirstOffset >= offsets.HighWaterMark {
+				break
+			}
+			if !batch.Control {
+				end = lastOffset(batch) + 1
+			}
+			covered = lastOffset(batch) + 1
+		}
+		switch {
+		case covered < offsets.HighWaterMark:
+			return offsets.HighWaterMark, nil
+		case end >= 0:
+			return min(end, offsets.HighWaterMark), nil
+		case from == offsets.Oldest:
+			// the partition only holds markers
+			return from, nil
+		}
+	}
+}
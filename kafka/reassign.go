@@ -0,0 +1,257 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+// ReassignmentPlan follows the JSON layout used by Kafka's kafka-reassign-partitions tool
+type ReassignmentPlan struct {
+	Version    int                     `json:"version"`
+	Partitions []PartitionReassignment `json:"partitions"`
+}
+
+type PartitionReassignment struct {
+	Topic     string   `json:"topic"`
+	Partition int32    `json:"partition"`
+	Replicas  []int32  `json:"replicas"`
+	LogDirs   []string `json:"log_dirs,omitempty"`
+}
+
+type ReassignmentStatus struct {
+	Topic            string
+	Partition        int32
+	Replicas         []int32
+	AddingReplicas   []int32
+	RemovingReplicas []int32
+	InProgress       bool
+}
+
+type ElectionResult struct {
+	Topic     string
+	Partition int32
+	Error     string
+}
+
+func LoadReassignmentPlan(fileName string) (ReassignmentPlan, error) {
+	plan := ReassignmentPlan{}
+	bytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return plan, err
+	}
+	if err = json.Unmarshal(bytes, &plan); err != nil {
+		return plan, err
+	}
+	if len(plan.Partitions) == 0 {
+		return plan, fmt.Errorf("no partitions found in reassignment plan %s", fileName)
+	}
+	return plan, nil
+}
+
+func (p ReassignmentPlan) topics() map[string][]PartitionReassignment {
+	result := make(map[string][]PartitionReassignment)
+	for _, pr := range p.Partitions {
+		result[pr.Topic] = append(result[pr.Topic], pr)
+	}
+	return result
+}
+
+/*
+ * Distributes the replicas of every partition of the topics evenly over the given brokers.
+ * The replication factor of each topic is kept and the preferred leader is rotated so that leadership is balanced as well.
+ */
+func GenerateReassignmentPlan(admin sarama.ClusterAdmin, topics []string, brokers []int32) (ReassignmentPlan, error) {
+	plan := ReassignmentPlan{Version: 1}
+	if len(brokers) == 0 {
+		return plan, fmt.Errorf("at least one broker is required to generate a reassignment plan")
+	}
+	metadata, err := admin.DescribeTopics(topics)
+	if err != nil {
+		return plan, err
+	}
+
+	sort.Slice(metadata, func(i, j int) bool {
+		return metadata[i].Name < metadata[j].Name
+	})
+
+	// keep rotating the start position between topics to avoid piling the leaders up on the first brokers
+	position := 0
+	for _, tm := range metadata {
+		if tm.Err != sarama.ErrNoError {
+			return plan, fmt.Errorf("cannot describe topic %s: %v", tm.Name, tm.Err)
+		}
+		sort.Slice(tm.Partitions, func(i, j int) bool {
+			return tm.Partitions[i].ID < tm.Partitions[j].ID
+		})
+		for _, pm := range tm.Partitions {
+			replicationFactor := len(pm.Replicas)
+			if replicationFactor > len(brokers) {
+				return plan, fmt.Errorf("topic %s has replication factor %d but only %d brokers were given", tm.Name, replicationFactor, len(brokers))
+			}
+			replicas := make([]int32, replicationFactor)
+			for r := 0; r < replicationFactor; r++ {
+				replicas[r] = brokers[(position+r)%len(brokers)]
+			}
+			position++
+			plan.Partitions = append(plan.Partitions, PartitionReassignment{
+				Topic:     tm.Name,
+				Partition: pm.ID,
+				Replicas:  replicas,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// ExecuteReassignmentPlan starts the reassignment of every partition in the plan (none of the topics may be in the middle of a reassignment)
+func ExecuteReassignmentPlan(admin sarama.ClusterAdmin, plan ReassignmentPlan) error {
+	// every topic is checked before the first one is reassigned
+	assignments := make(map[string][][]int32)
+	for topic, reassignments := range plan.topics() {
+		assignment, err := topicAssignment(admin, topic, reassignments)
+		if err != nil {
+			return err
+		}
+		assignments[topic] = assignment
+	}
+	for topic, assignment := range assignments {
+		if err := admin.AlterPartitionReassignments(topic, assignment); err != nil {
+			return fmt.Errorf("cannot reassign partitions of topic %s: %w", topic, requireVersion(err, "Reassigning partitions", "2.4"))
+		}
+	}
+	return nil
+}
+
+/*
+ * topicAssignment returns the replicas of every partition of a topic after the reassignments. sarama sends an
+ * assignment for every partition, so the partitions that are not reassigned get their current replicas (an empty
+ * assignment would cancel an ongoing reassignment). During a reassignment those are the union of the old and new
+ * replicas, so a topic with a partition that is being moved is refused.
+ */
+func topicAssignment(admin sarama.ClusterAdmin, topic string, reassignments []PartitionReassignment) ([][]int32, error) {
+	metadata, err := admin.DescribeTopics([]string{topic})
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata) == 0 || metadata[0].Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("cannot describe topic %s", topic)
+	}
+
+	assignment := make([][]int32, len(metadata[0].Partitions))
+	partitions := []int32{}
+	for _, pm := range metadata[0].Partitions {
+		if int(pm.ID) < len(assignment) {
+			assignment[pm.ID] = pm.Replicas
+		}
+		partitions = append(partitions, pm.ID)
+	}
+	for _, r := range reassignments {
+		if int(r.Partition) >= len(assignment) || r.Partition < 0 {
+			return nil, fmt.Errorf("topic %s does not have a partition %d", topic, r.Partition)
+		}
+		assignment[r.Partition] = r.Replicas
+	}
+
+	ongoing, err := admin.ListPartitionReassignments(topic, partitions)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the ongoing reassignments of topic %s: %w", topic, requireVersion(err, "Listing partition reassignments", "2.4"))
+	}
+	moving := []int32{}
+	for partition, status := range ongoing[topic] {
+		if status != nil {
+			moving = append(moving, partition)
+		}
+	}
+	if len(moving) > 0 {
+		sort.Slice(moving, func(i, j int) bool { return moving[i] < moving[j] })
+		return nil, fmt.Errorf("partition(s) %v of topic %s are already being reassigned - wait until that is done before starting another reassignment of the topic", moving, topic)
+	}
+	return assignment, nil
+}
+
+// ReassignmentProgress returns the status of every partition in the plan
+func ReassignmentProgress(admin sarama.ClusterAdmin, plan ReassignmentPlan) ([]ReassignmentStatus, error) {
+	statuses := []ReassignmentStatus{}
+	for topic, reassignments := range plan.topics() {
+		partitions := []int32{}
+		for _, r := range reassignments {
+			partitions = append(partitions, r.Partition)
+		}
+		ongoing, err := admin.ListPartitionReassignments(topic, partitions)
+		if err != nil {
+			return nil, requireVersion(err, "Listing partition reassignments", "2.4")
+		}
+		for _, r := range reassignments {
+			status := ReassignmentStatus{
+				Topic:     topic,
+				Partition: r.Partition,
+				Replicas:  r.Replicas,
+			}
+			if s, ok := ongoing[topic][r.Partition]; ok && s != nil {
+				status.Replicas = s.Replicas
+				status.AddingReplicas = s.AddingReplicas
+				status.RemovingReplicas = s.RemovingReplicas
+				status.InProgress = true
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Topic == statuses[j].Topic {
+			return statuses[i].Partition < statuses[j].Partition
+		}
+		return statuses[i].Topic < statuses[j].Topic
+	})
+	return statuses, nil
+}
+
+// ElectPreferredLeaders moves leadership of the partitions back to their preferred (first) replica
+func ElectPreferredLeaders(admin sarama.ClusterAdmin, topics []string) ([]ElectionResult, error) {
+	metadata, err := admin.DescribeTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+	partitions := make(map[string][]int32)
+	for _, tm := range metadata {
+		for _, pm := range tm.Partitions {
+			partitions[tm.Name] = append(partitions[tm.Name], pm.ID)
+		}
+	}
+
+	results, err := admin.ElectLeaders(sarama.PreferredElection, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	electionResults := []ElectionResult{}
+	for topic, partitionResults := range results {
+		for partition, pr := range partitionResults {
+			result := ElectionResult{
+				Topic:     topic,
+				Partition: partition,
+			}
+			// ElectionNotNeeded just means the preferred replica already is the leader
+			if pr != nil && pr.ErrorCode != sarama.ErrNoError && pr.ErrorCode != sarama.ErrElectionNotNeeded {
+				result.Error = pr.ErrorCode.Error()
+				if pr.ErrorMessage != nil {
+					result.Error = fmt.Sprintf("%s (%s)", result.Error, *pr.ErrorMessage)
+				}
+			}
+			electionResults = append(electionResults, result)
+		}
+	}
+
+	sort.Slice(electionResults, func(i, j int) bool {
+		if electionResults[i].Topic == electionResults[j].Topic {
+			return electionResults[i].Partition < electionResults[j].Partition
+		}
+		return electionResults[i].Topic < electionResults[j].Topic
+	})
+	return electionResults, nil
+}
@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// errResourceNotFound is returned by Kafka when a user does not have any SCRAM credentials (not defined by sarama)
+const errResourceNotFound = sarama.KError(91)
+
+type ScramCredentialInfo struct {
+	User       string
+	Mechanism  string
+	Iterations int32
+}
+
+// XDGSCRAMClient implements sarama.SCRAMClient so that SCRAM can be used to log in to the cluster
+type XDGSCRAMClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (x *XDGSCRAMClient) Begin(userName, password, authzID string) (err error) {
+	x.Client, err = x.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	x.ClientConversation = x.Client.NewConversation()
+	return nil
+}
+
+func (x *XDGSCRAMClient) Step(challenge string) (response string, err error) {
+	return x.ClientConversation.Step(challenge)
+}
+
+func (x *XDGSCRAMClient) Done() bool {
+	return x.ClientConversation.Done()
+}
+
+var (
+	SHA256 scram.HashGeneratorFcn = sha256.New
+	SHA512 scram.HashGeneratorFcn = sha512.New
+)
+
+// ScramMechanism converts 'sha256'/'sha512' (or the full SCRAM-SHA-xxx names) into a SCRAM mechanism
+func ScramMechanism(name string) (sarama.ScramMechanismType, error) {
+	switch strings.ToLower(strings.TrimPrefix(strings.ToUpper(name), "SCRAM-")) {
+	case "sha256", "sha-256":
+		return sarama.SCRAM_MECHANISM_SHA_256, nil
+	case "sha512", "sha-512":
+		return sarama.SCRAM_MECHANISM_SHA_512, nil
+	default:
+		return sarama.SCRAM_MECHANISM_UNKNOWN, fmt.Errorf("invalid SCRAM mechanism %s: can be either 'sha256' or 'sha512'", name)
+	}
+}
+
+// ListScramUsers describes the SCRAM credentials of the given users (or of all users if none are given)
+func ListScramUsers(admin sarama.ClusterAdmin, users []string) ([]ScramCredentialInfo, error) {
+	results, err := admin.DescribeUserScramCredentials(users)
+	if err != nil {
+		return nil, requireVersion(err, "Describing SCRAM credentials", "2.7")
+	}
+
+	infos := []ScramCredentialInfo{}
+	for _, r := range results {
+		if r.ErrorCode == errResourceNotFound {
+			continue
+		}
+		if r.ErrorCode != sarama.ErrNoError {
+			return nil, fmt.Errorf("cannot describe SCRAM user %s: %v", r.User, r.ErrorCode)
+		}
+		for _, ci := range r.CredentialInfos {
+			infos = append(infos, ScramCredentialInfo{
+				User:       r.User,
+				Mechanism:  ci.Mechanism.String(),
+				Iterations: ci.Iterations,
+			})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].User == infos[j].User {
+			return infos[i].Mechanism < infos[j].Mechanism
+		}
+		return infos[i].User < infos[j].User
+	})
+	return infos, nil
+}
+
+// UpsertScramUser creates or updates the credential of a user - the password is salted locally and never sent to the broker
+func UpsertScramUser(admin sarama.ClusterAdmin, user string, mechanism sarama.ScramMechanismType, iterations int32, password []byte) error {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	results, err := admin.UpsertUserScramCredentials([]sarama.AlterUserScramCredentialsUpsert{{
+		Name:       user,
+		Mechanism:  mechanism,
+		Iterations: iterations,
+		Salt:       salt,
+		Password:   password,
+	}})
+	if err != nil {
+		return requireVersion(err, "Altering SCRAM credentials", "2.7")
+	}
+	return alterScramResultsError(results)
+}
+
+func DeleteScramUser(admin sarama.ClusterAdmin, user string, mechanism sarama.ScramMechanismType) error {
+	results, err := admin.DeleteUserScramCredentials([]sarama.AlterUserScramCredentialsDelete{{
+		Name:      user,
+		Mechanism: mechanism,
+	}})
+	if err != nil {
+		return requireVersion(err, "Altering SCRAM credentials", "2.7")
+	}
+	return alterScramResultsError(results)
+}
+
+func alterScramResultsError(results []*sarama.AlterUserScramCredentialsResult) error {
+	for _, r := range results {
+		if r.ErrorCode != sarama.ErrNoError {
+			if r.ErrorMessage != nil {
+				return fmt.Errorf("%v: %s", r.ErrorCode, *r.ErrorMessage)
+			}
+			return r.ErrorCode
+		}
+	}
+	return nil
+}
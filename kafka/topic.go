@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+// AlterTopicConfig sets and deletes config entries of a topic - entries that are not mentioned are left untouched
+func AlterTopicConfig(admin sarama.ClusterAdmin, topic string, setEntries map[string]string, deleteEntries []string, validateOnly bool) error {
+	entries := make(map[string]sarama.IncrementalAlterConfigsEntry)
+	for name, value := range setEntries {
+		v := value
+		entries[name] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &v}
+	}
+	for _, name := range deleteEntries {
+		entries[name] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationDelete}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no config entries to alter for topic %s", topic)
+	}
+	return requireVersion(admin.IncrementalAlterConfig(sarama.TopicResource, topic, entries, validateOnly), "Altering topic configs", "2.3")
+}
+
+// ExtendPartitions increases the number of partitions of a topic to count (the number of partitions can never be decreased)
+func ExtendPartitions(admin sarama.ClusterAdmin, topic string, count int32, validateOnly bool) error {
+	metadata, err := admin.DescribeTopics([]string{topic})
+	if err != nil {
+		return err
+	}
+	if len(metadata) == 0 || metadata[0].Err != sarama.ErrNoError {
+		return fmt.Errorf("cannot describe topic %s", topic)
+	}
+	current := int32(len(metadata[0].Partitions))
+	if count <= current {
+		return fmt.Errorf("topic %s already has %d partitions", topic, current)
+	}
+	return admin.CreatePartitions(topic, count, nil, validateOnly)
+}
+
+// TopicConfigValue returns the value of a config entry of a topic, including values inherited from the broker defaults
+func TopicConfigValue(admin sarama.ClusterAdmin, topic string, name string) (string, error) {
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: topic, ConfigNames: []string{name}})
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return e.Value, nil
+		}
+	}
+	return "", fmt.Errorf("topic %s does not have config entry %s", topic, name)
+}
+
+// TopicSettings holds what is needed to recreate a topic
+type TopicSettings struct {
+	Partitions        int32
+	ReplicationFactor int16
+	// Configs holds the config entries set on the topic itself (not the broker defaults)
+	Configs map[string]string
+}
+
+func DescribeTopicSettings(admin sarama.ClusterAdmin, topic string) (TopicSettings, error) {
+	settings := TopicSettings{Configs: map[string]string{}}
+	metadata, err := admin.DescribeTopics([]string{topic})
+	if err != nil {
+		return settings, err
+	}
+	if len(metadata) == 0 || metadata[0].Err != sarama.ErrNoError || len(metadata[0].Partitions) == 0 {
+		return settings, fmt.Errorf("cannot describe topic %s", topic)
+	}
+	settings.Partitions = int32(len(metadata[0].Partitions))
+	settings.ReplicationFactor = int16(len(metadata[0].Partitions[0].Replicas))
+
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: topic})
+	if err != nil {
+		return settings, err
+	}
+	for _, e := range entries {
+		// older brokers do not report the source of a config entry
+		overridden := e.Source == sarama.SourceTopic || (e.Source == sarama.SourceUnknown && !e.Default)
+		if overridden && !e.ReadOnly && !e.Sensitive {
+			settings.Configs[e.Name] = e.Value
+		}
+	}
+	return settings, nil
+}
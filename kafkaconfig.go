@@ -5,7 +5,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	"github.com/henrikengstrom/jokk/kafka"
 )
 
@@ -32,8 +32,19 @@ func (k *kafkaConfig) validate(c map[string]KafkaSettings) error {
 	return nil
 }
 
+// defaultKafkaVersion is the oldest version that has every admin API jokk uses (SCRAM credentials need Kafka 2.7)
+var defaultKafkaVersion = sarama.V2_7_0_0
+
+// GetKafkaVersion returns the version of the protocol to use - sarama picks its requests by it and does not negotiate them
 func (k *kafkaConfig) GetKafkaVersion() (sarama.KafkaVersion, error) {
-	return sarama.DefaultVersion, nil
+	if k.KafkaVersion == "" || k.KafkaVersion == "DEFAULT" {
+		return defaultKafkaVersion, nil
+	}
+	version, err := sarama.ParseKafkaVersion(k.KafkaVersion)
+	if err != nil {
+		return version, fmt.Errorf("invalid kafka_version %s: %w", k.KafkaVersion, err)
+	}
+	return version, nil
 }
 
 func (k *kafkaConfig) kafkaConsumerConf() (conf *sarama.Config, err error) {
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/alexeyco/simpletable"
 	"github.com/henrikengstrom/jokk/kafka"
+	"github.com/henrikengstrom/jokk/schemaregistry"
 )
 
 const (
@@ -197,42 +200,493 @@ func CreateTopicDetailTable(tdi kafka.TopicDetailInfo, msgCounts24h []int, msgCo
 	return table.String()
 }
 
-func CreateMessagesTable(msgs []MsgInfo, width int) string {
+// CreateMessagesTable shows the newest messages first or, with the "partition" order, the messages of every partition in offset order
+func CreateMessagesTable(msgs []MsgInfo, width int, order string) string {
 	table := simpletable.New()
 	headers := []string{
 		"#",
 		"TIME",
+		"PARTITION",
 		"OFFSET",
+		"KEY",
+		"HEADERS",
 		"VALUE",
 	}
 	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
-	counter := len(msgs)
 
-	// order the messages based on descending time
-	sort.Slice(msgs, func(i, j int) bool {
-		return msgs[i].timestamp.After(msgs[j].timestamp)
-	})
+	sortMessages(msgs, order)
+	// the other columns and the borders take up about 140 characters
+	keyWidth := 24
+	headersWidth := 30
+	valueWidth := width - 140
+	if valueWidth < 20 {
+		valueWidth = 20
+	}
+	for c, msg := range msgs {
+		// in the time order the newest message gets the highest number
+		number := len(msgs) - c
+		if order == messageOrderPartition {
+			number = c + 1
+		}
+		rows := []string{
+			fmt.Sprintf("%d", number),
+			fmt.Sprintf("%v", msg.timestamp),
+			fmt.Sprintf("%d", msg.partition),
+			fmt.Sprintf("%d", msg.offset),
+			wrapText(msg.key, keyWidth),
+			wrapText(strings.ReplaceAll(msg.headers, ", ", "\n"), headersWidth),
+			wrapText(msg.value, valueWidth),
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+// wrapText splits text into lines of at most width characters
+func wrapText(text string, width int) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > width {
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func CreateReassignmentTable(statuses []kafka.ReassignmentStatus) string {
+	table := simpletable.New()
+	headers := []string{
+		"TOPIC",
+		"PARTITION",
+		"REPLICAS",
+		"ADDING",
+		"REMOVING",
+		"STATUS",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for _, s := range statuses {
+		status := "done"
+		if s.InProgress {
+			status = "in progress"
+		}
+		rows := []string{
+			s.Topic,
+			fmt.Sprintf("%d", s.Partition),
+			fmt.Sprintf("%v", s.Replicas),
+			fmt.Sprintf("%v", s.AddingReplicas),
+			fmt.Sprintf("%v", s.RemovingReplicas),
+			status,
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateElectionTable(results []kafka.ElectionResult) string {
+	table := simpletable.New()
+	headers := []string{
+		"TOPIC",
+		"PARTITION",
+		"RESULT",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for _, r := range results {
+		result := "ok"
+		if r.Error != "" {
+			result = r.Error
+		}
+		rows := []string{
+			r.Topic,
+			fmt.Sprintf("%d", r.Partition),
+			result,
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateAclTable(acls []kafka.AclInfo) string {
+	table := simpletable.New()
+	headers := []string{
+		"#",
+		"RESOURCE TYPE",
+		"RESOURCE NAME",
+		"PATTERN",
+		"PRINCIPAL",
+		"HOST",
+		"OPERATION",
+		"PERMISSION",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for c, acl := range acls {
+		rows := []string{
+			fmt.Sprintf("%d", c+1),
+			acl.ResourceType,
+			acl.ResourceName,
+			acl.PatternType,
+			acl.Principal,
+			acl.Host,
+			acl.Operation,
+			acl.Permission,
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateScramUserTable(users []kafka.ScramCredentialInfo) string {
+	table := simpletable.New()
+	headers := []string{
+		"#",
+		"USER",
+		"MECHANISM",
+		"ITERATIONS",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for c, u := range users {
+		rows := []string{
+			fmt.Sprintf("%d", c+1),
+			u.User,
+			u.Mechanism,
+			fmt.Sprintf("%d", u.Iterations),
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateQuotaTable(quotas []kafka.QuotaInfo) string {
+	table := simpletable.New()
+	headers := []string{
+		"#",
+		"ENTITY",
+		"PRODUCER BYTE RATE",
+		"CONSUMER BYTE RATE",
+		"REQUEST PERCENTAGE",
+		"OTHER",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
 
-	for _, msg := range msgs {
-		// Crude function to split a too long string value into a multi line value that fits the value cell
-		splitValue := ""
-		for i, v := range msg.value {
-			splitValue = splitValue + string(v)
-			// FIXME: need a better (more scientific number) here
-			if i%(width-80) == 0 {
-				splitValue = splitValue + "\n"
+	quotaValue := func(values map[string]float64, key string) string {
+		if v, ok := values[key]; ok {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return "-"
+	}
+
+	for c, q := range quotas {
+		others := []string{}
+		for k, v := range q.Values {
+			if k != kafka.ProducerByteRate && k != kafka.ConsumerByteRate && k != kafka.RequestPercentage {
+				others = append(others, fmt.Sprintf("%s=%s", k, strconv.FormatFloat(v, 'f', -1, 64)))
 			}
 		}
+		sort.Strings(others)
+		rows := []string{
+			fmt.Sprintf("%d", c+1),
+			q.Entity,
+			quotaValue(q.Values, kafka.ProducerByteRate),
+			quotaValue(q.Values, kafka.ConsumerByteRate),
+			quotaValue(q.Values, kafka.RequestPercentage),
+			strings.Join(others, ", "),
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
 
+	return table.String()
+}
+
+func CreateTopicOperationTable(results []TopicOperationResult) string {
+	table := simpletable.New()
+	headers := []string{
+		"TOPIC",
+		"RESULT",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for _, r := range results {
+		result := "ok"
+		if r.Error != "" {
+			result = r.Error
+		}
 		rows := []string{
-			fmt.Sprintf("%d", counter),
-			fmt.Sprintf("%v", msg.timestamp),
-			fmt.Sprintf("%d", msg.offset),
-			fmt.Sprintf("%s", splitValue),
+			r.Topic,
+			result,
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateSubjectTable(subjects []string) string {
+	table := simpletable.New()
+	headers := []string{
+		"#",
+		"SUBJECT",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for c, s := range subjects {
+		rows := []string{
+			fmt.Sprintf("%d", c+1),
+			s,
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateSubjectInfoTable(info schemaregistry.SubjectInfo) string {
+	table := simpletable.New()
+	headers := []string{
+		"SUBJECT",
+		"VERSIONS",
+		"COMPATIBILITY",
+		"LATEST VERSION",
+		"SCHEMA ID",
+		"TYPE",
+		"REFERENCES",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	references := []string{}
+	for _, r := range info.Latest.References {
+		references = append(references, fmt.Sprintf("%s (%s v%d)", r.Name, r.Subject, r.Version))
+	}
+	rows := []string{
+		info.Subject,
+		fmt.Sprintf("%v", info.Versions),
+		info.Compatibility,
+		fmt.Sprintf("%d", info.Latest.Version),
+		fmt.Sprintf("%d", info.Latest.Id),
+		info.Latest.SchemaType,
+		strings.Join(references, "\n"),
+	}
+	table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+
+	return table.String()
+}
+
+func CreateCompatibilityTable(result schemaregistry.CompatibilityResult) string {
+	table := simpletable.New()
+	headers := []string{
+		"SUBJECT",
+		"COMPATIBLE",
+		"MESSAGES",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	rows := []string{
+		result.Subject,
+		strconv.FormatBool(result.Compatible),
+		strings.Join(result.Messages, "\n"),
+	}
+	table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+
+	return table.String()
+}
+
+func CreateBackupTable(metadata BackupMetadata) string {
+	table := simpletable.New()
+	headers := []string{
+		"PARTITION",
+		"OLDEST OFFSET",
+		"HIGH WATER MARK",
+		"RECORDS",
+		"STOPPED AT",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for _, p := range metadata.PartitionInfo {
+		stoppedAt := "-"
+		if !p.complete() {
+			stoppedAt = fmt.Sprintf("%d", p.StoppedAt)
+		}
+		rows := []string{
+			fmt.Sprintf("%d", p.Partition),
+			fmt.Sprintf("%d", p.OldestOffset),
+			fmt.Sprintf("%d", p.HighWaterMark),
+			fmt.Sprintf("%d", p.Records),
+			stoppedAt,
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateRestoreTable(summary RestoreSummary) string {
+	table := simpletable.New()
+	headers := []string{
+		"PARTITION",
+		"RECORDS",
+		"ORIGINAL OFFSETS",
+		"RESTORED OFFSETS",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	offsets := func(first int64, last int64) string {
+		if first < 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%d - %d", first, last)
+	}
+	for _, p := range summary.Partitions {
+		rows := []string{
+			fmt.Sprintf("%d", p.Partition),
+			fmt.Sprintf("%d", p.Records),
+			offsets(p.FirstOffset, p.LastOffset),
+			offsets(p.RestoredFirstOffset, p.RestoredLastOffset),
 		}
 		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
-		counter--
 	}
 
 	return table.String()
 }
+
+func CreateReadProgressTable(progress []PartitionProgress) string {
+	table := simpletable.New()
+	headers := []string{
+		"PARTITION",
+		"HIGH WATER MARK",
+		"LAST OFFSET READ",
+		"MESSAGES READ",
+		"FULLY READ",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	for _, p := range progress {
+		lastOffset := "-"
+		if p.LastOffset >= 0 {
+			lastOffset = fmt.Sprintf("%d", p.LastOffset)
+		}
+		rows := []string{
+			fmt.Sprintf("%d", p.Partition),
+			fmt.Sprintf("%d", p.HighWaterMark),
+			lastOffset,
+			fmt.Sprintf("%d", p.Messages),
+			strconv.FormatBool(p.FullyRead),
+		}
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+	}
+
+	return table.String()
+}
+
+func CreateKeyLookupTable(lookup KeyLookup) string {
+	table := simpletable.New()
+	headers := []string{
+		"KEY",
+		"PARTITION",
+		"SCANNED",
+		"OFFSET",
+		"TIME",
+		"HEADERS",
+		"VALUE",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	offset, timestamp, headerText, value := "-", "-", "", "(not found)"
+	if lookup.Found {
+		offset = fmt.Sprintf("%d", lookup.Offset)
+		timestamp = lookup.Timestamp.Format("2006-01-02 15:04:05")
+		pairs := []string{}
+		for k, v := range lookup.Headers {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(pairs)
+		headerText = strings.Join(pairs, ", ")
+		switch v := lookup.Value.(type) {
+		case nil:
+			value = "(tombstone)"
+		case string:
+			value = v
+		default:
+			b, _ := json.Marshal(v)
+			value = string(b)
+		}
+	}
+	rows := []string{
+		lookup.Key,
+		fmt.Sprintf("%d", lookup.Partition),
+		fmt.Sprintf("%d", lookup.Scanned),
+		offset,
+		timestamp,
+		headerText,
+		value,
+	}
+	table.Body.Cells = append(table.Body.Cells, CreateTableRow(rows, simpletable.AlignCenter))
+
+	return table.String()
+}
+
+func CreateCompactionTable(report CompactionReport) string {
+	table := simpletable.New()
+	headers := []string{
+		"PARTITION",
+		"RECORDS",
+		"DISTINCT KEYS",
+		"DUPLICATE KEY RECORDS",
+		"TOMBSTONES",
+		"OLDEST TOMBSTONE",
+		"BYTES",
+		"OBSOLETE BYTES",
+		"DIRTY RATIO",
+	}
+	table.Header = CreateTableHeader(headers, simpletable.AlignCenter)
+
+	row := func(partition string, p PartitionCompaction) []string {
+		oldest := "-"
+		if p.OldestTombstone != nil {
+			oldest = p.OldestTombstone.Format("2006-01-02 15:04:05")
+		}
+		return []string{
+			partition,
+			fmt.Sprintf("%d", p.Records),
+			fmt.Sprintf("%d", p.DistinctKeys),
+			fmt.Sprintf("%d", p.DuplicateKeyRecords),
+			fmt.Sprintf("%d", p.Tombstones),
+			oldest,
+			fmt.Sprintf("%d", p.Bytes),
+			fmt.Sprintf("%d", p.ObsoleteBytes),
+			fmt.Sprintf("%.2f", p.DirtyRatio),
+		}
+	}
+	// partitions that could not be scanned completely (and the total they are part of) are marked with *
+	partial := func(label string, partial bool) string {
+		if partial {
+			return label + "*"
+		}
+		return label
+	}
+	for _, p := range report.Partitions {
+		table.Body.Cells = append(table.Body.Cells, CreateTableRow(row(partial(fmt.Sprintf("%d", p.Partition), p.Partial), p), simpletable.AlignCenter))
+	}
+	total := PartitionCompaction{
+		Records:             report.Records,
+		DistinctKeys:        report.DistinctKeys,
+		DuplicateKeyRecords: report.DuplicateKeyRecords,
+		Tombstones:          report.Tombstones,
+		OldestTombstone:     report.OldestTombstone,
+		Bytes:               report.Bytes,
+		ObsoleteBytes:       report.ObsoleteBytes,
+		DirtyRatio:          report.DirtyRatio,
+	}
+	table.Body.Cells = append(table.Body.Cells, CreateTableRow(row(partial("TOTAL", report.Partial), total), simpletable.AlignCenter))
+
+	return table.String()
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+const lookupReadBatchSize = 1000
+
+// KeyLookup is the result of getKey - the latest message with the key in the partition the key belongs to
+type KeyLookup struct {
+	Topic     string
+	Key       string
+	Partition int32
+	Scanned   int
+	Found     bool
+	Tombstone bool
+	Offset    int64             `json:",omitempty" yaml:",omitempty"`
+	Timestamp *time.Time        `json:",omitempty" yaml:",omitempty"`
+	Headers   map[string]string `json:",omitempty" yaml:",omitempty"`
+	Value     any               `json:",omitempty" yaml:",omitempty"`
+}
+
+// keyBytes converts a key given as text to the bytes producers write in the key format
+func keyBytes(format string, key string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", "auto", "string", "json":
+		return []byte(key), nil
+	case "hex":
+		return hex.DecodeString(key)
+	case "base64":
+		return base64.StdEncoding.DecodeString(key)
+	case "int64":
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int64 key %s", key)
+		}
+		return binary.BigEndian.AppendUint64(nil, uint64(n)), nil
+	case "uuid":
+		b, err := hex.DecodeString(strings.ReplaceAll(key, "-", ""))
+		if err != nil || len(b) != 16 {
+			return nil, fmt.Errorf("invalid UUID key %s", key)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("keys in the %s format cannot be looked up (string/hex/base64/json/int64/uuid)", format)
+	}
+}
+
+// keyPartition returns the partition a producer using the partitioner writes the key to
+func keyPartition(partitioner string, topic string, key []byte, partitions int32) (int32, error) {
+	if partitioner == "murmur2" {
+		return int32(murmur2(key)&0x7fffffff) % partitions, nil
+	}
+	return sarama.NewHashPartitioner(topic).Partition(&sarama.ProducerMessage{Key: sarama.ByteEncoder(key)}, partitions)
+}
+
+// murmur2 is the hash the default partitioner of the Java client uses for keys
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// incompleteScanError tells that a partition could not be scanned up to its high water mark
+type incompleteScanError struct {
+	partition     int32
+	offset        int64
+	highWaterMark int64
+}
+
+func (e *incompleteScanError) Error() string {
+	return fmt.Sprintf("partition %d could only be read up to offset %d of high water mark %d - no messages arrived after %d reads", e.partition, e.offset, e.highWaterMark, kafka.ReadRetries)
+}
+
+// scanPartition calls fn for every message of a partition from its oldest offset up to its high water mark
+func scanPartition(reader *kafka.PartitionReader, partition int32, fn func(msg *sarama.ConsumerMessage)) error {
+	oldest, highWaterMark, err := reader.OffsetRange(partition)
+	if err != nil {
+		return err
+	}
+	offset, err := reader.ReadRange(partition, oldest, highWaterMark, lookupReadBatchSize, func(msg *sarama.ConsumerMessage) error {
+		fn(msg)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if offset < highWaterMark {
+		return &incompleteScanError{partition: partition, offset: offset, highWaterMark: highWaterMark}
+	}
+	return nil
+}
+
+// findLatest returns the last message with the key in a partition (nil if there is none) and the number of messages scanned
+func findLatest(client sarama.Client, topic string, partition int32, key []byte) (*sarama.ConsumerMessage, int, error) {
+	reader, err := kafka.NewPartitionReader(client, topic)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	var latest *sarama.ConsumerMessage
+	scanned := 0
+	err = scanPartition(reader, partition, func(msg *sarama.ConsumerMessage) {
+		scanned++
+		if bytes.Equal(msg.Key, key) {
+			latest = msg
+		}
+	})
+	if err != nil {
+		return nil, scanned, err
+	}
+	return latest, scanned, nil
+}
+
+func getKey(client sarama.Client, decoders messageDecoders, topicName string, key string, args Args) (KeyLookup, *sarama.ConsumerMessage, error) {
+	lookup := KeyLookup{Topic: topicName, Key: key}
+	k, err := keyBytes(args.KeyFormat, key)
+	if err != nil {
+		return lookup, nil, usageErrorf("%v", err)
+	}
+	partitions, err := client.Partitions(topicName)
+	if err != nil {
+		return lookup, nil, err
+	}
+	if lookup.Partition, err = keyPartition(args.Partitioner, topicName, k, int32(len(partitions))); err != nil {
+		return lookup, nil, err
+	}
+
+	msg, scanned, err := findLatest(client, topicName, lookup.Partition, k)
+	lookup.Scanned = scanned
+	if err != nil || msg == nil {
+		return lookup, nil, err
+	}
+	lookup.Found = true
+	lookup.Tombstone = msg.Value == nil
+	lookup.Offset = msg.Offset
+	lookup.Timestamp = &msg.Timestamp
+	stored := decoders.decode(*msg)
+	lookup.Headers = stored.DecodedHeaders
+	if !lookup.Tombstone {
+		lookup.Value = stored.DecodedValue
+		if lookup.Value == nil {
+			lookup.Value = string(msg.Value)
+		}
+	}
+	return lookup, msg, nil
+}
+
+func getKeyConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, decoders messageDecoders, args Args) error {
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
+	key, err := valueOrDialogue(args, args.Key, "--key", "Enter the key to look up", "X")
+	if err != nil {
+		return err
+	}
+	lookup, _, err := getKey(client, decoders, topicName, key, args)
+	if err != nil {
+		return fmt.Errorf("could not look up key %s in topic %s: %w", key, topicName, err)
+	}
+
+	printResult(log, args, func() string { return CreateKeyLookupTable(lookup) }, lookup)
+	switch {
+	case !lookup.Found:
+		log.Infof("Key %s not found in partition %d of topic %s (%d messages scanned)", key, lookup.Partition, topicName, lookup.Scanned)
+	case lookup.Tombstone:
+		log.Infof("Key %s was deleted - the latest message at offset %d of partition %d is a tombstone", key, lookup.Offset, lookup.Partition)
+	default:
+		log.Infof("Latest value of key %s found at offset %d of partition %d (%d messages scanned)", key, lookup.Offset, lookup.Partition, lookup.Scanned)
+	}
+	return nil
+}
+
+// deleteKey produces a tombstone (a record without a value) for the key to the partition producers write the key to
+func deleteKey(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, brokers []string, config *sarama.Config, topicName string, key string, args Args) error {
+	k, err := keyBytes(args.KeyFormat, key)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	partitions, err := client.Partitions(topicName)
+	if err != nil {
+		return err
+	}
+	partition, err := keyPartition(args.Partitioner, topicName, k, int32(len(partitions)))
+	if err != nil {
+		return err
+	}
+	if policy, err := kafka.TopicConfigValue(admin, topicName, "cleanup.policy"); err == nil && !strings.Contains(policy, "compact") {
+		log.Warnf("Topic %s is not compacted (cleanup.policy=%s) - the tombstone does not remove earlier records with the key", topicName, policy)
+	}
+
+	if args.DryRun {
+		log.Infof("Dry run: a tombstone for key %s would be produced to partition %d of topic %s", key, partition, topicName)
+		return nil
+	}
+	if err = confirm(args, fmt.Sprintf("Delete key %s from partition %d of topic %s", key, partition, topicName)); err != nil {
+		return err
+	}
+
+	// the partition is computed above so that the tombstone lands where the key is, whatever partitioner is configured
+	deleteConfig := *config
+	deleteConfig.Producer.Partitioner = sarama.NewManualPartitioner
+	deleteConfig.Producer.Return.Successes = true
+	producer, err := kafka.NewProducer(brokers, &deleteConfig)
+	if err != nil {
+		return err
+	}
+	defer kafka.CloseProducer(log, producer)
+	// a nil Value is what makes the record a tombstone
+	_, offset, err := producer.SendMessage(&sarama.ProducerMessage{
+		Topic:     topicName,
+		Partition: partition,
+		Key:       sarama.ByteEncoder(k),
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Tombstone for key %s produced to partition %d of topic %s at offset %d", key, partition, topicName, offset)
+	return nil
+}
+
+func deleteKeyConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, brokers []string, config *sarama.Config, args Args) error {
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
+	key, err := valueOrDialogue(args, args.Key, "--key", "Enter the key to delete", "X")
+	if err != nil {
+		return err
+	}
+	if err = deleteKey(log, admin, client, brokers, config, topicName, key, args); err != nil {
+		return fmt.Errorf("could not delete key %s from topic %s: %w", key, topicName, err)
+	}
+	return nil
+}
@@ -1,20 +1,23 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 	"github.com/henrikengstrom/jokk/common"
 	"github.com/henrikengstrom/jokk/kafka"
+	"github.com/henrikengstrom/jokk/schemaregistry"
 	"github.com/jessevdk/go-flags"
 	hd "github.com/mitchellh/go-homedir"
 )
@@ -22,19 +25,99 @@ import (
 type Args struct {
 	CredentialsConfigFile string     `short:"c" long:"credentials-file" description:"File that contains the credentials" default:"./jokk.toml"`
 	Environment           string     `short:"n" long:"environment" description:"Dictates what configuration settings to use (from the jokk.toml file)"`
-	Filter                string     `short:"f" long:"filter" description:"Apply filter to narrow search result"`
+	Filter                string     `short:"f" long:"filter" description:"Apply filter to narrow search result (comma separated substrings, globs or 're:' regular expressions, '!' to exclude)"`
+	Topic                 string     `long:"topic" description:"Exact name of the topic to use (instead of -f/filter)"`
+	Exclude               []string   `long:"exclude" description:"Exclude topics matching the pattern (substring, glob or 're:' regular expression, can be repeated)"`
+	IncludeInternal       bool       `long:"include-internal" description:"Include internal topics (__consumer_offsets and other '__' topics, _schemas, _confluent*) - otherwise only a -f/filter pattern that is their exact name includes them"`
+	AllMatching           bool       `long:"all-matching" description:"Apply the command to all topics matching the filter (deleteTopic/clearTopic/alterTopicConfig/extendPartitions)"`
+	Workers               int        `long:"workers" description:"Number of topics to process concurrently with --all-matching" default:"4"`
 	StartTime             string     `short:"s" long:"start-time" description:"Start time format 'YYYY-MM-DD HH:MM:SS' (not applicable to all commands)"`
 	EndTime               string     `short:"e" long:"end-time" description:"End time format 'YYYY-MM-DD HH:MM:SS' (not applicable to all commands)"`
-	RecordFormat          string     `short:"r" long:"record-format" description:"Formatting to apply when storing messages (JSON/raw)" default:"JSON"`
+	RecordFormat          string     `short:"r" long:"record-format" description:"Formatting to apply when storing messages (JSON/NDJSON/CSV/avro/parquet/raw)" default:"JSON"`
+	Compress              string     `long:"compress" description:"Compress stored messages (writes a manifest next to the file)" choice:"gzip" choice:"zstd" choice:"snappy"`
+	MaxFileSize           string     `long:"max-file-size" description:"Start a new file when the current one reaches the size, e.g. '500MB' (writes a manifest next to the files)"`
+	MaxRecordsPerFile     int        `long:"max-records-per-file" description:"Start a new file after the number of messages (writes a manifest next to the files)"`
+	MessageOrder          string     `long:"message-order" description:"Order of viewed messages: newest first across partitions or grouped by partition in offset order" choice:"time" choice:"partition" default:"time"`
+	Follow                bool       `long:"follow" description:"Keep reading new messages after reaching the end of the topic (viewMessages/storeMessages, stop with Ctrl-C)"`
+	IdleTimeout           int        `long:"idle-timeout" description:"Seconds without messages after which viewMessages/storeMessages give up before reaching the end of the topic" default:"30"`
+	Resume                bool       `long:"resume" description:"Continue an interrupted storeMessages from the checkpoint next to --file and append to it"`
+	Key                   string     `long:"key" description:"Key to look up with getKey or delete with deleteKey (in the --key-format, e.g. hex or int64)"`
+	Partitioner           string     `long:"partitioner" description:"Partitioner the producers of the topic use to place keys: sarama's default or the Java client's murmur2" choice:"hash" choice:"murmur2" default:"hash"`
+	Columns               string     `long:"columns" description:"Comma separated CSV columns, e.g. 'offset,key,value.customer.id,header.trace-id' (default: partition,offset,timestamp,key,value)"`
+	KeyFormat             string     `long:"key-format" description:"Format of message keys (auto/string/hex/base64/json/msgpack/int64/uuid/registry/avro/protobuf)" default:"auto"`
+	ValueFormat           string     `long:"value-format" description:"Format of message values (auto/string/hex/base64/json/msgpack/int64/uuid/registry/avro/protobuf)" default:"auto"`
+	AvroSchema            string     `long:"avro-schema" description:"Avro schema file (.avsc) used by the avro format for messages without a schema registry header"`
+	ProtoDescriptorSet    string     `long:"proto-descriptor-set" description:"Protobuf descriptor set file (protoc --include_imports -o) used by the protobuf format"`
+	ProtoPath             string     `long:"proto-path" description:"Directory with .proto files used by the protobuf format (instead of --proto-descriptor-set)"`
+	ProtoMessage          string     `long:"proto-message" description:"Fully qualified protobuf message type, e.g. 'com.example.Order', used with --proto-descriptor-set/--proto-path"`
+	File                  string     `long:"file" description:"File to store messages to or import messages from (the archive of backupTopic/restoreTopic)"`
+	Partitions            int32      `long:"partitions" description:"Number of partitions of a new topic"`
+	ReplicationFactor     int16      `long:"replication-factor" description:"Replication factor of a new topic"`
+	Config                []string   `long:"config" description:"Topic config entry to set, format 'name=value' (can be repeated)"`
+	DeleteConfig          []string   `long:"delete-config" description:"Topic config entry to remove so that the default applies again (can be repeated)"`
+	HeaderFilter          []string   `long:"header-filter" description:"Only include messages with a matching header, format 'name=value' (can be repeated)"`
+	ValueMatch            string     `long:"value-match" description:"Only include messages whose value contains the given text"`
+	ReplayTopicHeader     string     `long:"replay-topic-header" description:"Header that holds the original topic of a dead-lettered message" default:"original-topic"`
+	ReplayTopic           string     `long:"replay-topic" description:"Topic to replay dead-lettered messages to (overrides --replay-topic-header)"`
+	StripHeaders          []string   `long:"strip-headers" description:"Remove headers starting with the given prefix before replaying (can be repeated)"`
+	JournalFile           string     `long:"journal-file" description:"File that keeps track of replayed messages" default:"./jokk-replay-journal.json"`
+	DryRun                bool       `long:"dry-run" description:"Preview the result without changing anything"`
+	PlanFile              string     `long:"plan-file" description:"Partition reassignment plan (JSON in the kafka-reassign-partitions format)"`
+	Generate              bool       `long:"generate" description:"Generate a balanced reassignment plan instead of executing one"`
+	BrokerIds             string     `long:"broker-ids" description:"Comma separated broker ids to use when generating a reassignment plan"`
+	ReassignTimeout       int        `long:"reassign-timeout" description:"Seconds reassignPartitions follows the reassignment before giving up (0 waits until it is done)" default:"3600"`
+	Principal             string     `long:"principal" description:"ACL principal, e.g. 'User:alice'"`
+	ResourceType          string     `long:"resource-type" description:"ACL resource type (any/topic/group/cluster/transactionalid/delegationtoken)"`
+	ResourceName          string     `long:"resource-name" description:"ACL resource name"`
+	ResourcePattern       string     `long:"resource-pattern" description:"ACL resource pattern type (any/match/literal/prefixed)"`
+	Operation             string     `long:"operation" description:"ACL operation, e.g. read/write/describe/all"`
+	Permission            string     `long:"permission" description:"ACL permission type (allow/deny)"`
+	AclHost               string     `long:"acl-host" description:"Host an ACL applies to (default for new ACLs: *)"`
+	ScramUser             string     `long:"scram-user" description:"SCRAM user name"`
+	ScramMechanism        string     `long:"scram-mechanism" description:"SCRAM mechanism (sha256/sha512)" default:"sha512"`
+	ScramIterations       int        `long:"scram-iterations" description:"Number of iterations used to salt SCRAM passwords" default:"8192"`
+	QuotaUser             string     `long:"quota-user" description:"User the quota applies to ('<default>' for the default user quota)"`
+	QuotaClientId         string     `long:"quota-client-id" description:"Client id the quota applies to ('<default>' for the default client-id quota)"`
+	QuotaIp               string     `long:"quota-ip" description:"IP address the quota applies to ('<default>' for the default IP quota)"`
+	ProducerByteRate      string     `long:"producer-byte-rate" description:"Producer byte rate quota in bytes/second ('remove' to remove it)"`
+	ConsumerByteRate      string     `long:"consumer-byte-rate" description:"Consumer byte rate quota in bytes/second ('remove' to remove it)"`
+	RequestPercentage     string     `long:"request-percentage" description:"Request percentage quota ('remove' to remove it)"`
+	Subject               string     `long:"subject" description:"Schema registry subject (default for --topic: '<topic>-value')"`
+	SchemaType            string     `long:"schema-type" description:"Type of the schema file (default: derived from the file extension)" choice:"avro" choice:"protobuf" choice:"json"`
 	ListTopics            JokkConfig `command:"listTopics" description:"List topics and related information"`
 	TopicInfo             JokkConfig `command:"topicInfo" description:"Detailed topic info (use -f/filter to determine topic(s))"`
 	AddTopic              JokkConfig `command:"addTopic" description:"Add a topic to the Kafka cluster"`
 	DeleteTopic           JokkConfig `command:"deleteTopic" description:"Delete a topic from the Kafka cluster (use -f/filter to determine topic)"`
 	ClearTopic            JokkConfig `command:"clearTopic" description:"Clear messages from a topic in the Kafka cluster (use -f/filter to determine topic)"`
+	AlterTopicConfig      JokkConfig `command:"alterTopicConfig" description:"Set or remove config entries of a topic (use -f/filter to determine topic)"`
+	ExtendPartitions      JokkConfig `command:"extendPartitions" description:"Increase the number of partitions of a topic to --partitions (use -f/filter to determine topic)"`
 	ViewMessages          JokkConfig `command:"viewMessages" description:"View messages in a topic (use -f/filter to determine topic)"`
 	StoreMessages         JokkConfig `command:"storeMessages" description:"Store messages from a topic to a file (use -f/filter to determine topic)"`
 	ImportMessages        JokkConfig `command:"importMessages" description:"Import/publish messages to a topic from a file (use -f/filter to determine topic)"`
+	CompactionReport      JokkConfig `command:"compactionReport" description:"Distinct keys, duplicate key records, tombstones and estimated dirty ratio of a compacted topic (use -f/filter to determine topic)"`
+	DeleteKey             JokkConfig `command:"deleteKey" description:"Produce a tombstone for --key to the partition the key belongs to, removing the key from a compacted topic (use -f/filter to determine topic)"`
+	GetKey                JokkConfig `command:"getKey" description:"Latest value of a key, reading only the partition the key belongs to (use -f/filter to determine topic)"`
+	BackupTopic           JokkConfig `command:"backupTopic" description:"Back up the settings and all messages of a topic to an archive file (use -f/filter to determine topic)"`
+	RestoreTopic          JokkConfig `command:"restoreTopic" description:"Restore a topic from a backupTopic archive (--topic to restore to another topic)"`
+	ReplayDLQ             JokkConfig `command:"replayDLQ" description:"Replay messages from a dead-letter topic to their source topic (use -f/filter to determine topic)"`
+	ElectLeaders          JokkConfig `command:"electLeaders" description:"Elect the preferred leaders for the partitions of topics (use -f/filter to determine topics)"`
+	ReassignPartitions    JokkConfig `command:"reassignPartitions" description:"Reassign partitions from a plan file or generate a balanced plan (use -f/filter to determine topics)"`
+	ListAcls              JokkConfig `command:"listAcls" description:"List ACLs (use --principal/--resource-type/--resource-pattern etc. to filter)"`
+	CreateAcl             JokkConfig `command:"createAcl" description:"Create an ACL"`
+	DeleteAcl             JokkConfig `command:"deleteAcl" description:"Delete the ACLs matching the given ACL filter"`
+	ListScramUsers        JokkConfig `command:"listScramUsers" description:"List SCRAM users and their mechanisms"`
+	CreateScramUser       JokkConfig `command:"createScramUser" description:"Create a SCRAM user (the password is entered through a hidden prompt)"`
+	UpdateScramUser       JokkConfig `command:"updateScramUser" description:"Change the password of a SCRAM user"`
+	DeleteScramUser       JokkConfig `command:"deleteScramUser" description:"Delete the credential of a SCRAM user"`
+	DescribeQuotas        JokkConfig `command:"describeQuotas" description:"Describe client quotas (use --quota-user/--quota-client-id/--quota-ip to filter)"`
+	AlterQuotas           JokkConfig `command:"alterQuotas" description:"Set or remove client quotas for a user, client id and/or IP"`
+	ListSubjects          JokkConfig `command:"listSubjects" description:"List schema registry subjects (use -f/filter to narrow down)"`
+	SubjectInfo           JokkConfig `command:"subjectInfo" description:"Versions, compatibility level and references of a subject (use --subject or -f/filter)"`
+	CheckCompatibility    JokkConfig `command:"checkCompatibility" description:"Check if a schema file is compatible with a subject: checkCompatibility <schema file>"`
 	InteractiveMode       JokkConfig `command:"interactive" description:"Interactive mode"`
+	Yes                   bool       `short:"y" long:"yes" description:"Confirm destructive operations without asking"`
+	NonInteractive        bool       `long:"non-interactive" description:"Never prompt - fail with a non-zero exit code when input is missing"`
+	Output                string     `short:"o" long:"output" description:"Output format of the command result (table/json/yaml/csv)" choice:"table" choice:"json" choice:"yaml" choice:"csv" default:"table"`
 	Verbose               bool       `short:"v" long:"verbose" description:"Display verbose information when available"`
 }
 
@@ -44,19 +127,34 @@ type KafkaSettings struct {
 	Username   string `toml:"username"`
 	Password   string `toml:"password"`
 	Algorithm  string `toml:"algorithm"`
+	// KafkaVersion is the version of the brokers, e.g. "2.4.0" - only needed for brokers older than the default (2.7.0)
+	KafkaVersion string `toml:"kafka_version"`
+	// The schema registry is optional and used to decode messages serialized with Avro, Protobuf or JSON Schema
+	SchemaRegistryUrl      string `toml:"schema_registry_url"`
+	SchemaRegistryUsername string `toml:"schema_registry_username"`
+	SchemaRegistryPassword string `toml:"schema_registry_password"`
+}
+
+// ProtobufMapping decodes the message values of the matching topics as a protobuf message type
+type ProtobufMapping struct {
+	Topic         string `toml:"topic"`
+	Message       string `toml:"message"`
+	ProtoPath     string `toml:"proto_path"`
+	DescriptorSet string `toml:"descriptor_set"`
 }
 
 type JokkConfig struct {
 	KafkaSettings map[string]KafkaSettings `toml:"kafka"`
+	Protobuf      []ProtobufMapping        `toml:"protobuf"`
 	kafkaConfig
 }
 
 func main() {
 	var log common.Logger = common.NewConsoleLogger()
-	log.Info("Welcome to Jokk")
 	var args Args
 	var parser = flags.NewParser(&args, flags.Default)
-	if _, err := parser.Parse(); err != nil {
+	extraArgs, err := parser.Parse()
+	if err != nil {
 		switch flagsErr := err.(type) {
 		case *flags.Error:
 			if flagsErr.Type == flags.ErrHelp {
@@ -70,26 +168,48 @@ func main() {
 		}
 	}
 
+	if args.NonInteractive && parser.Active.Name == "interactive" {
+		log.Errorf("interactive mode cannot be combined with --non-interactive")
+		os.Exit(exitUsage)
+	}
+
+	if _, err := newTopicMatcher(args); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+
+	if _, err := parseHeaderFilters(args.HeaderFilter); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+
+	// Keep stdout clean for the results when a machine-readable output format is used
+	if !tableOutput(args) && parser.Active.Name != "interactive" {
+		log = common.NewConsoleLoggerWithWriter(os.Stderr)
+	}
+	log.Info("Welcome to Jokk")
+
 	jokkConfig := JokkConfig{}
-	err := jokkConfig.loadFromFile(args.CredentialsConfigFile)
+	err = jokkConfig.loadFromFile(args.CredentialsConfigFile)
 	if err != nil {
 		log.Errorf("could not load or parse configuration file: %s", err)
 		os.Exit(1)
 	}
 
+	log.Infof("running settings for environment: %s", args.Environment)
+	kafkaSettings := jokkConfig.KafkaSettings[args.Environment]
+
 	// Set up kafka stuff
+	jokkConfig.kafkaConfig.KafkaVersion = kafkaSettings.KafkaVersion
 	kc, err := jokkConfig.kafkaConfig.kafkaConsumerConf()
 	if err != nil {
-		log.Panic("cannot create kafka consumer config")
+		log.Panicf("cannot create kafka consumer config: %v", err)
 	}
 	pc, err := jokkConfig.kafkaConfig.kafkaProducerConf()
 	if err != nil {
-		log.Panic("cannot create kafka producer config")
+		log.Panicf("cannot create kafka producer config: %v", err)
 	}
 
-	log.Infof("running settings for environment: %s", args.Environment)
-	kafkaSettings := jokkConfig.KafkaSettings[args.Environment]
-
 	if kafkaSettings.EnableSasl {
 		kc, err = kafka.EnableSasl(log,
 			kc,
@@ -117,29 +237,93 @@ func main() {
 	}
 	defer consumer.Close()
 
+	var registry *schemaregistry.Client
+	if kafkaSettings.SchemaRegistryUrl != "" {
+		log.Infof("using schema registry: %s", kafkaSettings.SchemaRegistryUrl)
+		registry = schemaregistry.NewClient(kafkaSettings.SchemaRegistryUrl, kafkaSettings.SchemaRegistryUsername, kafkaSettings.SchemaRegistryPassword)
+	}
+	decoders, err := newMessageDecoders(args, registry, jokkConfig.Protobuf)
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+
 	switch parser.Active.Name {
 	case "interactive":
-		MainLoop(log, admin, client, consumer, kc, pc, args, kafkaSettings.Host)
+		MainLoop(log, admin, client, consumer, registry, decoders, kc, pc, args, kafkaSettings.Host)
 	case "listTopics":
 		listTopics(log, admin, client, args)
 	case "topicInfo":
-		topicInfoConsole(log, admin, client, args)
+		err = topicInfoConsole(log, admin, client, args)
 	case "addTopic":
-		addTopicConsole(log, admin, client, args)
+		err = addTopicConsole(log, admin, client, args)
 	case "deleteTopic":
-		deleteTopicConsole(log, admin, client, args)
+		err = deleteTopicConsole(log, admin, client, args)
 	case "clearTopic":
-		clearTopicConsole(log, admin, client, args)
+		err = clearTopicConsole(log, admin, client, args)
+	case "alterTopicConfig":
+		err = alterTopicConfigConsole(log, admin, args)
+	case "extendPartitions":
+		err = extendPartitionsConsole(log, admin, args)
 	case "viewMessages":
-		viewMessagesConsole(log, admin, consumer, kc, args)
+		err = viewMessagesConsole(log, admin, client, consumer, decoders, kc, args)
 	case "storeMessages":
-		storeMessagesConsole(log, admin, consumer, kc, args)
+		err = storeMessagesConsole(log, admin, client, consumer, decoders, kc, args)
 	case "importMessages":
-		importMessagesConsole(log, admin, []string{kafkaSettings.Host}, pc, args)
+		_, err = importMessagesConsole(log, admin, []string{kafkaSettings.Host}, pc, args)
+	case "compactionReport":
+		err = compactionReportConsole(log, admin, client, args)
+	case "deleteKey":
+		err = deleteKeyConsole(log, admin, client, []string{kafkaSettings.Host}, pc, args)
+	case "getKey":
+		err = getKeyConsole(log, admin, client, decoders, args)
+	case "backupTopic":
+		err = backupTopicConsole(log, admin, client, args)
+	case "restoreTopic":
+		err = restoreTopicConsole(log, admin, []string{kafkaSettings.Host}, pc, args)
+	case "replayDLQ":
+		err = replayDLQConsole(log, admin, consumer, decoders, []string{kafkaSettings.Host}, pc, args)
+	case "electLeaders":
+		err = electLeadersConsole(log, admin, args)
+	case "reassignPartitions":
+		err = reassignPartitionsConsole(log, admin, args)
+	case "listAcls":
+		err = listAclsConsole(log, admin, args)
+	case "createAcl":
+		err = createAclConsole(log, admin, args)
+	case "deleteAcl":
+		err = deleteAclConsole(log, admin, args)
+	case "listScramUsers":
+		err = listScramUsersConsole(log, admin, args)
+	case "createScramUser":
+		err = upsertScramUserConsole(log, admin, args, true)
+	case "updateScramUser":
+		err = upsertScramUserConsole(log, admin, args, false)
+	case "deleteScramUser":
+		err = deleteScramUserConsole(log, admin, args)
+	case "describeQuotas":
+		err = describeQuotasConsole(log, admin, args)
+	case "alterQuotas":
+		err = alterQuotasConsole(log, admin, args)
+	case "listSubjects":
+		err = listSubjectsConsole(log, registry, args)
+	case "subjectInfo":
+		err = subjectInfoConsole(log, registry, args)
+	case "checkCompatibility":
+		err = checkCompatibilityConsole(log, registry, args, extraArgs)
 	default:
 		log.Error("no command provided - exiting")
 		os.Exit(0)
 	}
+
+	if err != nil {
+		if errors.Is(err, errAborted) {
+			log.Infof("%v", err)
+		} else {
+			log.Errorf("%v", err)
+		}
+		os.Exit(exitCode(err))
+	}
 }
 
 func screenLoop(log common.Logger) {
@@ -201,9 +385,14 @@ func (jc *JokkConfig) loadFromFile(file string) error {
 func listTopics(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) (map[string]sarama.TopicDetail, []kafka.TopicInfo) {
 	topics, _ := admin.ListTopics()
 	topicsInfo := []kafka.TopicInfo{}
+	matcher, err := newTopicMatcher(args)
+	if err != nil {
+		log.Errorf("%v", err)
+		return topics, topicsInfo
+	}
 	var wg sync.WaitGroup
 	for topic, topicDetailInfo := range topics {
-		if strings.Contains(topic, args.Filter) {
+		if matcher.matches(topic) {
 			wg.Add(1)
 			go func(t string, td sarama.TopicDetail) {
 				pci := kafka.PartitionMessageCount(client, t, kafka.OldestOffset)
@@ -223,20 +412,32 @@ func listTopics(log common.Logger, admin sarama.ClusterAdmin, client sarama.Clie
 		}
 	}
 	wg.Wait()
-	log.Infof("\n%s", CreateTopicTable(topicsInfo, args.Verbose, args.Filter))
+	sort.Slice(topicsInfo, func(i, j int) bool {
+		return topicsInfo[i].GeneralTopicInfo.Name < topicsInfo[j].GeneralTopicInfo.Name
+	})
+	printResult(log, args, func() string { return CreateTopicTable(topicsInfo, args.Verbose, args.Filter) }, topicsInfo)
 	return topics, topicsInfo
 }
 
-func topicInfoConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) {
-	topics, _ := admin.ListTopics()
-	// Count topics matching the filter
-	filteredTopics, filteredTopicNames, hits := filterTopics(topics, args.Filter)
-	topicName, topicDetail := pickTopic(log, filteredTopics, filteredTopicNames, hits, args.Filter)
-	topicInfo(log, topicName, topicDetail, admin, client)
+func topicInfoConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) error {
+	topicName, topicDetail, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
+	topicInfo(log, topicName, topicDetail, admin, client, args)
+	return nil
+}
+
+// TopicDetailOutput is the machine-readable result of the topicInfo command
+type TopicDetailOutput struct {
+	kafka.TopicDetailInfo
+	MessageCounts24h []int
+	MessageCounts1h  []int
+	MessageCounts1m  []int
 }
 
 // FIXME : topic info should use activated time period for messages etc.
-func topicInfo(log common.Logger, topicName string, topicDetail sarama.TopicDetail, admin sarama.ClusterAdmin, client sarama.Client) (kafka.TopicDetailInfo, []int, []int, []int) {
+func topicInfo(log common.Logger, topicName string, topicDetail sarama.TopicDetail, admin sarama.ClusterAdmin, client sarama.Client, args Args) (kafka.TopicDetailInfo, []int, []int, []int) {
 	pdci := kafka.DetailedPartitionInfo(admin, client, topicName)
 	topicsDetailInfo := kafka.TopicDetailInfo{
 		GeneralTopicInfo: kafka.GeneralTopicInfo{
@@ -251,30 +452,52 @@ func topicInfo(log common.Logger, topicName string, topicDetail sarama.TopicDeta
 	}
 
 	msgCounts24h, msgCounts1h, msgCounts1m := kafka.TimeBasedPartitionCount(client, topicName)
-	log.Infof("\n%s", CreateTopicDetailTable(topicsDetailInfo, msgCounts24h, msgCounts1h, msgCounts1m))
+	printResult(log, args, func() string { return CreateTopicDetailTable(topicsDetailInfo, msgCounts24h, msgCounts1h, msgCounts1m) }, TopicDetailOutput{
+		TopicDetailInfo:  topicsDetailInfo,
+		MessageCounts24h: msgCounts24h,
+		MessageCounts1h:  msgCounts1h,
+		MessageCounts1m:  msgCounts1m,
+	})
 	return topicsDetailInfo, msgCounts24h, msgCounts1h, msgCounts1m
 }
 
-func addTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) {
-	log.Infof("topic creation process (enter 0 to exit)")
-	topicName := dialogue("enter topic name", "0")
-	numPartitionsStr := dialogue("number of partitions", "0")
-	numPartitions, err := strconv.Atoi(numPartitionsStr)
+func addTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) error {
+	if !args.NonInteractive {
+		log.Infof("topic creation process (enter 0 to exit)")
+	}
+	topicName, err := valueOrDialogue(args, args.Topic, "--topic", "enter topic name", "0")
 	if err != nil {
-		log.Infof("cannot convert %s to a number - exiting", numPartitionsStr)
-		os.Exit(1)
+		return err
 	}
-	replicationFactorStr := dialogue("replication factor", "0")
-	replicationFactor, err := strconv.Atoi(replicationFactorStr)
+	numPartitions, err := numberOrDialogue(args, int(args.Partitions), "--partitions", "number of partitions")
 	if err != nil {
-		log.Infof("cannot convert %s to a number - exiting", numPartitionsStr)
-		os.Exit(1)
+		return err
 	}
+	replicationFactor, err := numberOrDialogue(args, int(args.ReplicationFactor), "--replication-factor", "replication factor")
+	if err != nil {
+		return err
+	}
+
+	return addTopic(topicName, int32(numPartitions), int16(replicationFactor), log, admin)
+}
 
-	addTopic(topicName, int32(numPartitions), int16(replicationFactor), log, admin)
+// numberOrDialogue returns the number given on the command line or asks for it when running interactively
+func numberOrDialogue(args Args, value int, flag string, question string) (int, error) {
+	if value > 0 {
+		return value, nil
+	}
+	answer, err := valueOrDialogue(args, "", flag, question, "0")
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.Atoi(answer)
+	if err != nil || number < 1 {
+		return 0, usageErrorf("cannot convert %s to a positive number", answer)
+	}
+	return number, nil
 }
 
-func addTopic(topicName string, numPartitions int32, replicationFactor int16, log common.Logger, admin sarama.ClusterAdmin) {
+func addTopic(topicName string, numPartitions int32, replicationFactor int16, log common.Logger, admin sarama.ClusterAdmin) error {
 	err := admin.CreateTopic(topicName, &sarama.TopicDetail{
 		NumPartitions:     numPartitions,
 		ReplicationFactor: replicationFactor,
@@ -283,36 +506,34 @@ func addTopic(topicName string, numPartitions int32, replicationFactor int16, lo
 	}, false)
 
 	if err != nil {
-		log.Errorf("Could not create topic %s - %v", topicName, err)
-	} else {
-		log.Infof("Topic %s created", topicName)
+		return fmt.Errorf("could not create topic %s: %w", topicName, err)
 	}
+	log.Infof("Topic %s created", topicName)
+	return nil
 }
 
-func deleteTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) {
-	topics, _ := admin.ListTopics()
-	filteredTopics, filteredTopicNames, hits := filterTopics(topics, args.Filter)
-	topicName, _ := pickTopic(log, filteredTopics, filteredTopicNames, hits, args.Filter)
-	deleteTopic(topicName, log, admin)
+func deleteTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) error {
+	return topicOperationConsole(log, admin, args, "delete", true, func(topicName string) error {
+		return deleteTopic(topicName, log, admin)
+	})
 }
 
-func deleteTopic(topicName string, log common.Logger, admin sarama.ClusterAdmin) {
+func deleteTopic(topicName string, log common.Logger, admin sarama.ClusterAdmin) error {
 	err := admin.DeleteTopic(topicName)
 	if err != nil {
-		log.Errorf("Could not delete topic %s - %v", topicName, err)
-	} else {
-		log.Infof("Topic %s deleted", topicName)
+		return fmt.Errorf("could not delete topic %s: %w", topicName, err)
 	}
+	log.Infof("Topic %s deleted", topicName)
+	return nil
 }
 
-func clearTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) {
-	topics, _ := admin.ListTopics()
-	filteredTopics, filteredTopicNames, hits := filterTopics(topics, args.Filter)
-	topicName, _ := pickTopic(log, filteredTopics, filteredTopicNames, hits, args.Filter)
-	clearTopic(topicName, log, admin, client)
+func clearTopicConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, args Args) error {
+	return topicOperationConsole(log, admin, args, "clear", true, func(topicName string) error {
+		return clearTopic(topicName, log, admin, client)
+	})
 }
 
-func clearTopic(topicName string, log common.Logger, admin sarama.ClusterAdmin, client sarama.Client) {
+func clearTopic(topicName string, log common.Logger, admin sarama.ClusterAdmin, client sarama.Client) error {
 	partitionInfo := kafka.DetailedPartitionInfo(admin, client, topicName)
 	offsets := make(map[int32]int64)
 	for _, pdi := range partitionInfo.Partitions {
@@ -320,20 +541,59 @@ func clearTopic(topicName string, log common.Logger, admin sarama.ClusterAdmin,
 	}
 	err := admin.DeleteRecords(topicName, offsets)
 	if err != nil {
-		log.Errorf("Could not clear topic: %s - %v", topicName, err)
-	} else {
-		log.Infof("Messages have been cleared from topic: %s", topicName)
+		return fmt.Errorf("could not clear topic %s: %w", topicName, err)
+	}
+	log.Infof("Messages have been cleared from topic: %s", topicName)
+	return nil
+}
+
+func alterTopicConfigConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	setEntries := make(map[string]string)
+	for _, c := range args.Config {
+		parts := strings.SplitN(c, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return usageErrorf("invalid config entry '%s' - expected format 'name=value'", c)
+		}
+		setEntries[parts[0]] = parts[1]
 	}
+	if len(setEntries) == 0 && len(args.DeleteConfig) == 0 {
+		return usageErrorf("nothing to alter (use --config and/or --delete-config)")
+	}
+
+	return topicOperationConsole(log, admin, args, "alter config of", false, func(topicName string) error {
+		if err := kafka.AlterTopicConfig(admin, topicName, setEntries, args.DeleteConfig, false); err != nil {
+			return fmt.Errorf("could not alter config of topic %s: %w", topicName, err)
+		}
+		log.Infof("Config of topic %s altered", topicName)
+		return nil
+	})
 }
 
-func viewMessagesConsole(log common.Logger, admin sarama.ClusterAdmin, consumer kafka.JokkConsumer, config *sarama.Config, args Args) {
-	topics, _ := admin.ListTopics()
-	filteredTopics, filteredTopicNames, hits := filterTopics(topics, args.Filter)
-	topicName, _ := pickTopic(log, filteredTopics, filteredTopicNames, hits, args.Filter)
+func extendPartitionsConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	if args.Partitions < 1 {
+		return usageErrorf("the new number of partitions is required (use --partitions)")
+	}
+
+	return topicOperationConsole(log, admin, args, "extend partitions of", false, func(topicName string) error {
+		if err := kafka.ExtendPartitions(admin, topicName, args.Partitions, false); err != nil {
+			return fmt.Errorf("could not extend partitions of topic %s: %w", topicName, err)
+		}
+		log.Infof("Topic %s now has %d partitions", topicName, args.Partitions)
+		return nil
+	})
+}
+
+func viewMessagesConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, consumer kafka.JokkConsumer, decoders messageDecoders, config *sarama.Config, args Args) error {
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return err
+	}
 	resultChan := make(chan sarama.ConsumerMessage)
 	commandChan := make(chan string)
 
-	go viewMessages(topicName, log, consumer, args, resultChan, commandChan)
+	go viewMessages(topicName, log, client, consumer, decoders, args, resultChan, commandChan)
+	msgs := []StoredMessage{}
+	grouped := []MsgInfo{}
 Loop:
 	for {
 		select {
@@ -341,9 +601,19 @@ Loop:
 			// Check if this is an empty message to indicate that there are no more messages to view
 			if msg.Topic == "" {
 				break Loop
+			} else if !tableOutput(args) {
+				// machine-readable output collects all messages without asking
+				msgs = append(msgs, decoders.decode(msg))
+				commandChan <- "Y"
+			} else if args.MessageOrder == messageOrderPartition {
+				// the messages can only be grouped by partition once all of them have been read
+				grouped = append(grouped, MsgInfo{timestamp: msg.Timestamp, partition: msg.Partition, offset: msg.Offset, key: decoders.keyText(msg), headers: headersText(msg), value: decoders.valueText(msg)})
+				commandChan <- "Y"
 			} else {
-				log.Infof("[Time : Offset: Value] %v : %d : %v", msg.Timestamp, msg.Offset, msg.Value)
-				if dialogue("View another = enter (S to stop)", "S") == "S" {
+				log.Infof("[Time : Partition : Offset : Key : Headers : Value] %v : %d : %d : %s : %s : %s", msg.Timestamp, msg.Partition, msg.Offset, decoders.keyText(msg), headersText(msg), decoders.valueText(msg))
+				if args.NonInteractive {
+					commandChan <- "Y"
+				} else if _, err := dialogue(args, "View another = enter (S to stop)", "S"); err != nil {
 					commandChan <- "N"
 					break Loop
 				} else {
@@ -352,120 +622,183 @@ Loop:
 			}
 		}
 	}
-}
 
-func viewMessages(topicName string, log common.Logger, consumer kafka.JokkConsumer, args Args, resultChan chan sarama.ConsumerMessage, commandChan chan string) {
-	consumer.StartReceivingMessages(topicName)
+	if !tableOutput(args) {
+		if args.MessageOrder == messageOrderPartition {
+			sort.SliceStable(msgs, func(i, j int) bool {
+				if msgs[i].Partition != msgs[j].Partition {
+					return msgs[i].Partition < msgs[j].Partition
+				}
+				return msgs[i].Offset < msgs[j].Offset
+			})
+		}
+		if err = writeOutput(os.Stdout, args.Output, msgs); err != nil {
+			return fmt.Errorf("could not write %s output: %w", args.Output, err)
+		}
+	} else if args.MessageOrder == messageOrderPartition {
+		log.Infof("\n%s", CreateMessagesTable(grouped, terminalWidth(), args.MessageOrder))
+	}
+	return nil
+}
 
+func viewMessages(topicName string, log common.Logger, client sarama.Client, consumer kafka.JokkConsumer, decoders messageDecoders, args Args, resultChan chan sarama.ConsumerMessage, commandChan chan string) {
 	start, end, err := parseTime(log, args.StartTime, args.EndTime)
 	if err != nil {
+		resultChan <- sarama.ConsumerMessage{}
 		return
 	}
+	progress, err := newReadProgress(client, topicName, nil)
+	if err != nil {
+		log.Errorf("%v", err)
+		resultChan <- sarama.ConsumerMessage{}
+		return
+	}
+	headerFilters, _ := parseHeaderFilters(args.HeaderFilter)
+	consumer.StartReceivingMessages(topicName)
 
-	msgTicker := time.NewTicker(3 * time.Second)
+	idle := newIdleTimer(args)
+	defer idle.Stop()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
 	log.Infof("Viewing messages from - to: %s - %s", args.StartTime, args.EndTime)
 Loop:
-	for {
+	for args.Follow || !progress.done() {
 		select {
-		case <-msgTicker.C:
-			log.Infof("Did not find any messages - exiting")
-			resultChan <- sarama.ConsumerMessage{}
+		case <-interrupt:
+			break Loop
+		case <-idle.C:
+			log.Warnf("No messages arrived for %d seconds - exiting", args.IdleTimeout)
 			break Loop
 		case msg := <-consumer.MsgChannel:
-			if (start.Before(msg.Timestamp)) && end.After(msg.Timestamp) {
+			if !progress.consumed(msg) && !args.Follow {
+				continue
+			}
+			if (start.Before(msg.Timestamp)) && end.After(msg.Timestamp) && messageMatches(decoders, msg, headerFilters, args.ValueMatch) {
 				resultChan <- msg
 				cmd := <-commandChan
 				if cmd == "N" {
-					break Loop
+					progress.logSummary(log, args)
+					return
 				}
 			}
-			msgTicker = time.NewTicker(3 * time.Second)
+			idle.Reset(idleTimeout(args))
 		}
 	}
+	progress.logSummary(log, args)
+	// an empty message tells the receiver that there are no more messages to view
+	resultChan <- sarama.ConsumerMessage{}
 	//consumer.Close()
 }
 
-func storeMessagesConsole(log common.Logger, admin sarama.ClusterAdmin, consumer kafka.JokkConsumer, config *sarama.Config, args Args) error {
-	fileName := dialogue("Enter a file name to use", "X")
-	topics, _ := admin.ListTopics()
-	filteredTopics, filteredTopicNames, hits := filterTopics(topics, args.Filter)
-	topicName, _ := pickTopic(log, filteredTopics, filteredTopicNames, hits, args.Filter)
-	return storeMessages(log, fileName, topicName, consumer, args)
+func idleTimeout(args Args) time.Duration {
+	return time.Duration(args.IdleTimeout) * time.Second
 }
 
-func storeMessages(log common.Logger, fileName string, topicName string, consumer kafka.JokkConsumer, args Args) error {
-	f, err := os.Create(fileName)
+// newIdleTimer returns a timer that fires when no message arrived for --idle-timeout (it never fires with --follow)
+func newIdleTimer(args Args) *time.Timer {
+	idle := time.NewTimer(idleTimeout(args))
+	if args.Follow {
+		idle.Stop()
+	}
+	return idle
+}
+
+func storeMessagesConsole(log common.Logger, admin sarama.ClusterAdmin, client sarama.Client, consumer kafka.JokkConsumer, decoders messageDecoders, config *sarama.Config, args Args) error {
+	fileName, err := valueOrDialogue(args, args.File, "--file", "Enter a file name to use", "X")
+	if err != nil {
+		return err
+	}
+	topicName, _, err := pickTopic(log, admin, args)
 	if err != nil {
-		log.Errorf("Could not create file: %s - %v", fileName, err)
 		return err
 	}
+	return storeMessages(log, fileName, topicName, client, consumer, decoders, args)
+}
+
+func storeMessages(log common.Logger, fileName string, topicName string, client sarama.Client, consumer kafka.JokkConsumer, decoders messageDecoders, args Args) error {
+	writer, err := newDumpWriter(fileName, topicName, decoders, args)
+	if err != nil {
+		return fmt.Errorf("could not write to file %s: %w", fileName, err)
+	}
 
-	consumer.StartReceivingMessages(topicName)
 	start, end, err := parseTime(log, args.StartTime, args.EndTime)
 	if err != nil {
-		log.Errorf("Could not parse time for file: %s - %v", fileName, err)
+		return fmt.Errorf("could not parse time for file %s: %w", fileName, err)
+	}
+	offsets := writer.resumeOffsets()
+	progress, err := newReadProgress(client, topicName, offsets)
+	if err != nil {
 		return err
 	}
-	msgTicker := time.NewTicker(3 * time.Second)
-	f.WriteString("[")
-	first := true
+	if args.Resume {
+		log.Infof("Resuming after %d messages from the offsets %v", writer.manifest.Records, offsets)
+		consumer.StartReceivingMessagesFrom(topicName, offsets)
+	} else {
+		consumer.StartReceivingMessages(topicName)
+	}
+	headerFilters, _ := parseHeaderFilters(args.HeaderFilter)
+
+	idle := newIdleTimer(args)
+	defer idle.Stop()
+	// with --follow the file is finished properly when the run is interrupted
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
 Loop:
-	for {
+	for args.Follow || !progress.done() {
 		select {
-		case <-msgTicker.C:
-			log.Infof("Did not find any (additional) message - exiting")
+		case <-interrupt:
+			log.Infof("Interrupted - finishing the file(s)")
+			break Loop
+		case <-idle.C:
+			log.Warnf("No messages arrived for %d seconds - exiting", args.IdleTimeout)
 			break Loop
 		case msg := <-consumer.MsgChannel:
-			if (start.Before(msg.Timestamp)) && end.After(msg.Timestamp) {
-				if args.RecordFormat == "JSON" {
-					b, _ := json.MarshalIndent(msg, "", "    ")
-					if first {
-						first = false
-						f.WriteString(string(b))
-					} else {
-						f.WriteString(fmt.Sprintf(",%s", string(b)))
-					}
-				} else {
-					b := msg.Value
-					f.Write(b)
+			idle.Reset(idleTimeout(args))
+			if !progress.consumed(msg) && !args.Follow {
+				continue
+			}
+			if (start.Before(msg.Timestamp)) && end.After(msg.Timestamp) && messageMatches(decoders, msg, headerFilters, args.ValueMatch) {
+				if err = writer.write(msg); err != nil {
+					return fmt.Errorf("could not write message to file %s: %w", fileName, err)
 				}
-				msgTicker = time.NewTicker(1 * time.Second)
+			} else if err = writer.skip(msg); err != nil {
+				return fmt.Errorf("could not write checkpoint for file %s: %w", fileName, err)
 			}
 		}
 	}
 
-	f.WriteString("]")
-	log.Infof("Finished writing messages to file: %s", fileName)
-	f.Close()
+	if err = writer.close(); err != nil {
+		return fmt.Errorf("could not write to file %s: %w", fileName, err)
+	}
+	progress.logSummary(log, args)
+	log.Infof("Finished writing %d messages to file(s): %s", writer.manifest.Records, strings.Join(writer.files(), ", "))
 	return nil
 }
 
 func importMessagesConsole(log common.Logger, admin sarama.ClusterAdmin, brokers []string, config *sarama.Config, args Args) (int, error) {
-	fileName := dialogue("Enter a file name to use", "X")
-	topics, _ := admin.ListTopics()
-	filteredTopics, filteredTopicNames, hits := filterTopics(topics, args.Filter)
-	topicName, _ := pickTopic(log, filteredTopics, filteredTopicNames, hits, args.Filter)
+	fileName, err := valueOrDialogue(args, args.File, "--file", "Enter a file name to use", "X")
+	if err != nil {
+		return 0, err
+	}
+	topicName, _, err := pickTopic(log, admin, args)
+	if err != nil {
+		return 0, err
+	}
 	msgCount, err := importMessages(log, fileName, topicName, brokers, config, args)
 	if err != nil {
-		log.Infof("Could not import messages from file: %s, %v", fileName, err)
-	} else {
-		log.Infof("Imported %d messages to topic %s", msgCount, topicName)
+		return msgCount, fmt.Errorf("could not import messages from file %s: %w", fileName, err)
 	}
-	return msgCount, err
+	log.Infof("Imported %d messages to topic %s", msgCount, topicName)
+	return msgCount, nil
 }
 
 func importMessages(log common.Logger, fileName string, topicName string, brokers []string, config *sarama.Config, args Args) (int, error) {
 	log.Infof("reading from file: %s\n", fileName)
 
-	bytes, err := os.ReadFile(fileName)
-	if err != nil {
-		return 0, err
-	}
-
-	log.Infof("bytes len: %d\n", len(bytes))
-
-	msgs := []sarama.ConsumerMessage{}
-	err = json.Unmarshal(bytes, &msgs)
+	// a plain JSON file, a manifest or a directory with a manifest
+	chunks, manifest, err := dumpChunks(fileName)
 	if err != nil {
 		return 0, err
 	}
@@ -474,20 +807,40 @@ func importMessages(log common.Logger, fileName string, topicName string, broker
 	if err != nil {
 		return 0, err
 	}
-
-	for _, cMsg := range msgs {
-		// TODO : any other info to use?
-		pMsg := sarama.ProducerMessage{
-			Topic:     topicName,
-			Partition: cMsg.Partition,
-			Key:       sarama.ByteEncoder(cMsg.Key),
-			Value:     sarama.ByteEncoder(cMsg.Value),
-		}
-		_, _, err = producer.SendMessage(&pMsg)
+	defer kafka.CloseProducer(log, producer)
+
+	msgCount := 0
+	for _, chunk := range chunks {
+		log.Infof("importing messages from: %s", chunk)
+		err = readDumpChunk(chunk, manifest, func(cMsg sarama.ConsumerMessage) error {
+			// TODO : any other info to use?
+			pMsg := sarama.ProducerMessage{
+				Topic:     topicName,
+				Partition: cMsg.Partition,
+				Headers:   []sarama.RecordHeader{},
+			}
+			// keep nil keys and values nil so that tombstones are imported as tombstones
+			if cMsg.Key != nil {
+				pMsg.Key = sarama.ByteEncoder(cMsg.Key)
+			}
+			if cMsg.Value != nil {
+				pMsg.Value = sarama.ByteEncoder(cMsg.Value)
+			}
+			for _, h := range cMsg.Headers {
+				if h != nil {
+					pMsg.Headers = append(pMsg.Headers, *h)
+				}
+			}
+			if _, _, err := producer.SendMessage(&pMsg); err != nil {
+				return err
+			}
+			msgCount++
+			return nil
+		})
 		if err != nil {
-			return 0, err
+			return msgCount, err
 		}
 	}
 
-	return len(msgs), nil
+	return msgCount, nil
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/decoder"
+	"github.com/henrikengstrom/jokk/schemaregistry"
+)
+
+// StoredMessage is a consumed message together with its key and value decoded with the --key-format and --value-format
+// and its header values as text (the Headers of the message itself are base64 encoded in JSON)
+type StoredMessage struct {
+	sarama.ConsumerMessage `yaml:",inline"`
+	DecodedKey             any               `json:",omitempty" yaml:",omitempty"`
+	DecodedValue           any               `json:",omitempty" yaml:",omitempty"`
+	DecodedHeaders         map[string]string `json:",omitempty" yaml:",omitempty"`
+	DecodeError            string            `json:",omitempty" yaml:",omitempty"`
+}
+
+// messageDecoders holds the decoders used for message keys and values
+type messageDecoders struct {
+	key   decoder.Decoder
+	value decoder.Decoder
+	// topics mapped to a protobuf message type in jokk.toml, used instead of the auto value format
+	topicValues []topicDecoder
+}
+
+type topicDecoder struct {
+	matches func(string) bool
+	decoder decoder.Decoder
+}
+
+func newMessageDecoders(args Args, registry *schemaregistry.Client, mappings []ProtobufMapping) (messageDecoders, error) {
+	options := decoder.Options{
+		Registry:          registry,
+		AvroSchemaFile:    args.AvroSchema,
+		DescriptorSetFile: args.ProtoDescriptorSet,
+		ProtoPath:         args.ProtoPath,
+		MessageType:       args.ProtoMessage,
+	}
+	key, err := decoder.New(args.KeyFormat, options)
+	if err != nil {
+		return messageDecoders{}, usageErrorf("invalid --key-format: %v", err)
+	}
+	value, err := decoder.New(args.ValueFormat, options)
+	if err != nil {
+		return messageDecoders{}, usageErrorf("invalid --value-format: %v", err)
+	}
+	decoders := messageDecoders{key: key, value: value}
+
+	if strings.ToLower(args.ValueFormat) != "auto" {
+		return decoders, nil
+	}
+	for _, m := range mappings {
+		if m.Topic == "" || m.Message == "" || (m.ProtoPath == "") == (m.DescriptorSet == "") {
+			return decoders, usageErrorf("invalid protobuf mapping in jokk.toml for topic '%s': topic, message and either proto_path or descriptor_set are required", m.Topic)
+		}
+		matches, err := namePatternMatcher(m.Topic)
+		if err != nil {
+			return decoders, usageErrorf("invalid protobuf mapping in jokk.toml: %v", err)
+		}
+		// the .proto files are only compiled if a matching topic is read
+		decoders.topicValues = append(decoders.topicValues, topicDecoder{
+			matches: matches,
+			decoder: decoder.Lazy("protobuf", decoder.Options{
+				DescriptorSetFile: m.DescriptorSet,
+				ProtoPath:         m.ProtoPath,
+				MessageType:       m.Message,
+			}),
+		})
+	}
+	return decoders, nil
+}
+
+// valueDecoder returns the decoder of the first protobuf mapping that matches the topic or the --value-format decoder
+func (d messageDecoders) valueDecoder(topic string) decoder.Decoder {
+	for _, t := range d.topicValues {
+		if t.matches(topic) {
+			return t.decoder
+		}
+	}
+	return d.value
+}
+
+// text returns the decoded payload if possible and the raw payload otherwise
+func text(d decoder.Decoder, data []byte) string {
+	decoded, err := d.Decode(data)
+	if err != nil {
+		return string(data)
+	}
+	return decoded
+}
+
+func (d messageDecoders) keyText(msg sarama.ConsumerMessage) string {
+	return text(d.key, msg.Key)
+}
+
+func (d messageDecoders) valueText(msg sarama.ConsumerMessage) string {
+	return text(d.valueDecoder(msg.Topic), msg.Value)
+}
+
+// decodedField returns what to store for a decoded payload - nothing if decoding did not change it, JSON as is and other text as a string
+func decodedField(data []byte, decoded string) any {
+	if decoded == string(data) {
+		return nil
+	}
+	var v any
+	if json.Unmarshal([]byte(decoded), &v) == nil {
+		return v
+	}
+	return decoded
+}
+
+func (d messageDecoders) decode(msg sarama.ConsumerMessage) StoredMessage {
+	stored := StoredMessage{ConsumerMessage: msg}
+	errs := []string{}
+	if key, err := d.key.Decode(msg.Key); err != nil {
+		errs = append(errs, "key: "+err.Error())
+	} else {
+		stored.DecodedKey = decodedField(msg.Key, key)
+	}
+	if value, err := d.valueDecoder(msg.Topic).Decode(msg.Value); err != nil {
+		errs = append(errs, "value: "+err.Error())
+	} else {
+		stored.DecodedValue = decodedField(msg.Value, value)
+	}
+	if len(msg.Headers) > 0 {
+		stored.DecodedHeaders = map[string]string{}
+		for _, h := range msg.Headers {
+			if h != nil {
+				stored.DecodedHeaders[string(h.Key)] = string(h.Value)
+			}
+		}
+	}
+	stored.DecodeError = strings.Join(errs, ", ")
+	return stored
+}
+
+// headersText returns the headers of a message as 'name=value' pairs
+func headersText(msg sarama.ConsumerMessage) string {
+	headers := []string{}
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, fmt.Sprintf("%s=%s", h.Key, h.Value))
+		}
+	}
+	return strings.Join(headers, ", ")
+}
+
+// messageMatches applies the --header-filter and --value-match search arguments to a message (the value is searched in its decoded form)
+func messageMatches(decoders messageDecoders, msg sarama.ConsumerMessage, headerFilters map[string]string, valueMatch string) bool {
+	if !matchesHeaderFilters(msg, headerFilters) {
+		return false
+	}
+	return valueMatch == "" || strings.Contains(decoders.valueText(msg), valueMatch)
+}
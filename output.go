@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/henrikengstrom/jokk/common"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputCSV   = "csv"
+)
+
+func tableOutput(args Args) bool {
+	return args.Output == "" || args.Output == OutputTable
+}
+
+// printResult logs the table representation of a result or, if another output format is used, writes the result itself to stdout
+func printResult(log common.Logger, args Args, table func() string, result any) {
+	if tableOutput(args) {
+		log.Infof("\n%s", table())
+		return
+	}
+	if err := writeOutput(os.Stdout, args.Output, result); err != nil {
+		log.Errorf("Could not write %s output - %v", args.Output, err)
+	}
+}
+
+func writeOutput(w io.Writer, format string, result any) error {
+	switch format {
+	case OutputJSON:
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case OutputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case OutputCSV:
+		headers, records := csvRecords(result)
+		writer := csv.NewWriter(w)
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(records); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+/*
+ * Flattens a struct, or a slice of structs, into CSV records.
+ * Nested structs become dot separated columns while slices and maps are written as JSON in a single column.
+ */
+func csvRecords(result any) ([]string, [][]string) {
+	rv := reflect.ValueOf(result)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+
+	headers := []string{}
+	records := [][]string{}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			h, record := flattenCsv("", rv.Index(i))
+			if i == 0 {
+				headers = h
+			}
+			records = append(records, record)
+		}
+	} else {
+		h, record := flattenCsv("", rv)
+		headers = h
+		records = append(records, record)
+	}
+	return headers, records
+}
+
+func flattenCsv(prefix string, rv reflect.Value) ([]string, []string) {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return []string{prefixed(prefix, "value")}, []string{""}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || rv.Type() == reflect.TypeOf(time.Time{}) {
+		return []string{prefixed(prefix, "value")}, []string{csvCell(rv)}
+	}
+
+	headers := []string{}
+	values := []string{}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			h, v := flattenCsv(prefixed(prefix, field.Name), fv)
+			headers = append(headers, h...)
+			values = append(values, v...)
+			continue
+		}
+		headers = append(headers, prefixed(prefix, field.Name))
+		values = append(values, csvCell(fv))
+	}
+	return headers, values
+}
+
+func prefixed(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func csvCell(rv reflect.Value) string {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return ""
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return ""
+		}
+		return csvCell(rv.Elem())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+		b, _ := json.Marshal(rv.Interface())
+		return string(b)
+	case reflect.Struct:
+		if t, ok := rv.Interface().(time.Time); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+		b, _ := json.Marshal(rv.Interface())
+		return string(b)
+	default:
+		return fmt.Sprint(rv.Interface())
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+func parseBrokerIds(brokerIds string) ([]int32, error) {
+	ids := []int32{}
+	for _, s := range strings.Split(brokerIds, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker id: %s", s)
+		}
+		ids = append(ids, int32(id))
+	}
+	return ids, nil
+}
+
+func electLeadersConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	topicNames, err := matchingTopics(admin, args)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("electing preferred leaders for %d topic(s)", len(topicNames))
+	results, err := kafka.ElectPreferredLeaders(admin, topicNames)
+	if err != nil {
+		return fmt.Errorf("could not elect preferred leaders: %w", err)
+	}
+	printResult(log, args, func() string { return CreateElectionTable(results) }, results)
+	return nil
+}
+
+func reassignPartitionsConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	if args.Generate {
+		return generateReassignmentPlan(log, admin, args)
+	}
+
+	if args.PlanFile == "" {
+		return usageErrorf("a reassignment plan is required (use --plan-file or --generate)")
+	}
+	plan, err := kafka.LoadReassignmentPlan(args.PlanFile)
+	if err != nil {
+		return fmt.Errorf("could not load reassignment plan %s: %w", args.PlanFile, err)
+	}
+
+	if args.DryRun {
+		statuses := []kafka.ReassignmentStatus{}
+		for _, pr := range plan.Partitions {
+			statuses = append(statuses, kafka.ReassignmentStatus{Topic: pr.Topic, Partition: pr.Partition, Replicas: pr.Replicas})
+		}
+		log.Infof("Dry run: the following reassignment would be started")
+		printResult(log, args, func() string { return CreateReassignmentTable(statuses) }, statuses)
+		return nil
+	}
+
+	if err = kafka.ExecuteReassignmentPlan(admin, plan); err != nil {
+		return fmt.Errorf("could not start reassignment: %w", err)
+	}
+	log.Infof("Reassignment of %d partition(s) started", len(plan.Partitions))
+	return reassignmentProgress(log, admin, plan, args)
+}
+
+func generateReassignmentPlan(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	brokers, err := parseBrokerIds(args.BrokerIds)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	if len(brokers) == 0 {
+		return usageErrorf("a list of broker ids is required to generate a plan (use --broker-ids)")
+	}
+
+	topicNames, err := matchingTopics(admin, args)
+	if err != nil {
+		return err
+	}
+
+	plan, err := kafka.GenerateReassignmentPlan(admin, topicNames, brokers)
+	if err != nil {
+		return fmt.Errorf("could not generate reassignment plan: %w", err)
+	}
+	b, _ := json.MarshalIndent(plan, "", "  ")
+	if args.PlanFile == "" {
+		if tableOutput(args) {
+			log.Infof("Proposed reassignment plan:\n%s", string(b))
+		} else if err = writeOutput(os.Stdout, args.Output, plan); err != nil {
+			return fmt.Errorf("could not write %s output: %w", args.Output, err)
+		}
+		return nil
+	}
+	if err = os.WriteFile(args.PlanFile, b, 0644); err != nil {
+		return fmt.Errorf("could not write reassignment plan to file %s: %w", args.PlanFile, err)
+	}
+	log.Infof("Reassignment plan for %d partition(s) written to file: %s", len(plan.Partitions), args.PlanFile)
+	return nil
+}
+
+const (
+	reassignmentPollInterval = 5 * time.Second
+	// reassignmentErrorRetries is how many times in a row the progress may fail to be retrieved before giving up
+	reassignmentErrorRetries = 3
+)
+
+// reassignmentProgress polls the status of the reassignment until every partition has been moved, --reassign-timeout has passed or the run is interrupted
+func reassignmentProgress(log common.Logger, admin sarama.ClusterAdmin, plan kafka.ReassignmentPlan, args Args) error {
+	var deadline <-chan time.Time
+	if args.ReassignTimeout > 0 {
+		timer := time.NewTimer(time.Duration(args.ReassignTimeout) * time.Second)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	poll := time.NewTicker(reassignmentPollInterval)
+	defer poll.Stop()
+
+	failures := 0
+	for {
+		statuses, err := kafka.ReassignmentProgress(admin, plan)
+		if err != nil {
+			failures++
+			if failures >= reassignmentErrorRetries {
+				return fmt.Errorf("could not retrieve reassignment progress: %w", err)
+			}
+			log.Warnf("Could not retrieve reassignment progress (attempt %d of %d): %v", failures, reassignmentErrorRetries, err)
+		} else {
+			failures = 0
+			inProgress := 0
+			for _, s := range statuses {
+				if s.InProgress {
+					inProgress++
+				}
+			}
+			if inProgress == 0 {
+				log.Infof("Reassignment completed")
+				printResult(log, args, func() string { return CreateReassignmentTable(statuses) }, statuses)
+				return nil
+			}
+			if tableOutput(args) {
+				log.Infof("\n%s", CreateReassignmentTable(statuses))
+			}
+			log.Infof("%d of %d partition(s) still being reassigned", inProgress, len(statuses))
+		}
+
+		// the reassignment is carried out by the cluster, so it goes on when jokk stops following it
+		select {
+		case <-interrupt:
+			return fmt.Errorf("interrupted - the reassignment continues in the cluster")
+		case <-deadline:
+			return fmt.Errorf("the reassignment did not finish within %d seconds - it continues in the cluster", args.ReassignTimeout)
+		case <-poll.C:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+// PartitionProgress tells how far a partition was read compared to its high water mark when the run started
+type PartitionProgress struct {
+	Partition     int32
+	HighWaterMark int64
+	// End is the offset after the last message a consumer gets - below the high water mark if the partition ends with transaction markers
+	End int64
+	// LastOffset is the offset of the last message read (-1 if none was read)
+	LastOffset int64
+	Messages   int
+	FullyRead  bool
+}
+
+/*
+ * The readProgress decides when viewMessages and storeMessages are done: the high water mark of every partition is
+ * taken when the run starts and the run is finished when every partition has reached it. Messages produced after the
+ * start are beyond the high water mark and not part of the run (unless --follow is used).
+ * The markers that commit or abort transactions take up offsets but are never delivered, so a partition of a
+ * transactional topic is read up to the last offset before its trailing markers (its End) instead.
+ */
+type readProgress struct {
+	partitions map[int32]*PartitionProgress
+}
+
+// newReadProgress takes the high water marks of a topic - startOffsets are the offsets a resumed run continues from
+func newReadProgress(client sarama.Client, topic string, startOffsets map[int32]int64) (*readProgress, error) {
+	offsets, err := kafka.TopicOffsets(client, topic)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the high water marks of topic %s: %w", topic, err)
+	}
+	progress := &readProgress{partitions: map[int32]*PartitionProgress{}}
+	for p, o := range offsets {
+		start := o.Oldest
+		if offset, ok := startOffsets[p]; ok && offset > start {
+			start = offset
+		}
+		// without the end (e.g. on brokers before Kafka 0.11) the partition is read up to the high water mark
+		end, _ := kafka.ReadEnd(client, topic, p, o)
+		progress.partitions[p] = &PartitionProgress{
+			Partition:     p,
+			HighWaterMark: o.HighWaterMark,
+			End:           end,
+			LastOffset:    -1,
+			FullyRead:     start >= end,
+		}
+	}
+	return progress, nil
+}
+
+// consumed keeps track of a message and returns false if it was produced after the run started
+func (r *readProgress) consumed(msg sarama.ConsumerMessage) bool {
+	p, ok := r.partitions[msg.Partition]
+	if !ok {
+		// a partition that was added after the run started
+		return false
+	}
+	if msg.Offset >= p.HighWaterMark {
+		p.FullyRead = true
+		return false
+	}
+	p.LastOffset = msg.Offset
+	p.Messages++
+	if msg.Offset+1 >= p.End {
+		p.FullyRead = true
+	}
+	return true
+}
+
+// done returns true when every partition has reached its high water mark
+func (r *readProgress) done() bool {
+	for _, p := range r.partitions {
+		if !p.FullyRead {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *readProgress) list() []PartitionProgress {
+	list := []PartitionProgress{}
+	for _, p := range r.partitions {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Partition < list[j].Partition })
+	return list
+}
+
+// logSummary logs the progress of every partition and whether all of them were fully read
+func (r *readProgress) logSummary(log common.Logger, args Args) {
+	list := r.list()
+	if tableOutput(args) {
+		log.Infof("\n%s", CreateReadProgressTable(list))
+	}
+	incomplete := []string{}
+	for _, p := range list {
+		if !p.FullyRead {
+			incomplete = append(incomplete, fmt.Sprintf("%d", p.Partition))
+		}
+	}
+	if len(incomplete) == 0 {
+		log.Infof("Every partition (%d) was read up to its high water mark", len(list))
+	} else {
+		log.Warnf("Not every partition was fully read - partition(s) %s did not reach their high water mark", strings.Join(incomplete, ", "))
+	}
+}
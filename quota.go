@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+func quotaEntitySpec(args Args) kafka.QuotaEntitySpec {
+	return kafka.QuotaEntitySpec{
+		User:     args.QuotaUser,
+		ClientId: args.QuotaClientId,
+		Ip:       args.QuotaIp,
+	}
+}
+
+func describeQuotasConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	quotas, err := kafka.DescribeQuotas(admin, quotaEntitySpec(args))
+	if err != nil {
+		return fmt.Errorf("could not describe quotas: %w", err)
+	}
+	printResult(log, args, func() string { return CreateQuotaTable(quotas) }, quotas)
+	return nil
+}
+
+// quotaChange is a parsed --producer-byte-rate/--consumer-byte-rate/--request-percentage argument (a nil value removes the quota)
+type quotaChange struct {
+	key   string
+	value *float64
+}
+
+func (c quotaChange) op() sarama.ClientQuotasOp {
+	op := sarama.ClientQuotasOp{Key: c.key, Remove: c.value == nil}
+	if c.value != nil {
+		op.Value = *c.value
+	}
+	return op
+}
+
+func (c quotaChange) String() string {
+	if c.value == nil {
+		return fmt.Sprintf("%s removed", c.key)
+	}
+	return fmt.Sprintf("%s set to %s", c.key, strconv.FormatFloat(*c.value, 'f', -1, 64))
+}
+
+// parseQuotaChanges validates all quota arguments before anything is changed and returns them in a fixed order
+func parseQuotaChanges(args Args) ([]quotaChange, error) {
+	arguments := []struct {
+		key    string
+		change string
+	}{
+		{kafka.ProducerByteRate, args.ProducerByteRate},
+		{kafka.ConsumerByteRate, args.ConsumerByteRate},
+		{kafka.RequestPercentage, args.RequestPercentage},
+	}
+	changes := []quotaChange{}
+	for _, a := range arguments {
+		if a.change == "" {
+			continue
+		}
+		change := quotaChange{key: a.key}
+		if strings.ToLower(a.change) != "remove" {
+			v, err := strconv.ParseFloat(a.change, 64)
+			if err != nil || v < 0 {
+				return nil, usageErrorf("invalid value for %s: %s", a.key, a.change)
+			}
+			change.value = &v
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func alterQuotasConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	spec := quotaEntitySpec(args)
+	changes, err := parseQuotaChanges(args)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		log.Infof("nothing to alter (use --producer-byte-rate, --consumer-byte-rate or --request-percentage)")
+		return nil
+	}
+
+	ops := []sarama.ClientQuotasOp{}
+	for _, change := range changes {
+		ops = append(ops, change.op())
+	}
+	if args.DryRun {
+		if err := kafka.AlterQuotas(admin, spec, ops, true); err != nil {
+			return fmt.Errorf("could not validate the quota changes: %w", err)
+		}
+		for _, change := range changes {
+			log.Infof("Dry run: %s", change)
+		}
+		log.Infof("Dry run: the quota changes were validated but not applied")
+		return nil
+	}
+
+	// all changes go in one request so that a rejected change does not leave the others applied
+	if err := kafka.AlterQuotas(admin, spec, ops, false); err != nil {
+		return fmt.Errorf("could not alter the quotas (nothing was changed): %w", err)
+	}
+	for _, change := range changes {
+		log.Info(change.String())
+	}
+	return describeQuotasConsole(log, admin, args)
+}
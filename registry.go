@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/schemaregistry"
+)
+
+func requireRegistry(registry *schemaregistry.Client, args Args) error {
+	if registry == nil {
+		return usageErrorf("no schema registry configured for environment %s (add schema_registry_url to jokk.toml)", args.Environment)
+	}
+	return nil
+}
+
+// pickSubject selects the --subject, the value subject of --topic or one of the subjects matching the filter
+func pickSubject(log common.Logger, registry *schemaregistry.Client, args Args) (string, error) {
+	if args.Subject != "" {
+		return args.Subject, nil
+	}
+	if args.Topic != "" {
+		return args.Topic + "-value", nil
+	}
+	subjects, err := matchingSubjects(registry, args)
+	if err != nil {
+		return "", err
+	}
+	return pickName(log, args, subjects, "subject")
+}
+
+func matchingSubjects(registry *schemaregistry.Client, args Args) ([]string, error) {
+	matcher, err := newTopicMatcher(args)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	subjects, err := registry.Subjects()
+	if err != nil {
+		return nil, fmt.Errorf("could not list subjects: %w", err)
+	}
+	matching := []string{}
+	for _, s := range subjects {
+		if matcher.matches(s) {
+			matching = append(matching, s)
+		}
+	}
+	return matching, nil
+}
+
+func listSubjectsConsole(log common.Logger, registry *schemaregistry.Client, args Args) error {
+	if err := requireRegistry(registry, args); err != nil {
+		return err
+	}
+	subjects, err := matchingSubjects(registry, args)
+	if err != nil {
+		return err
+	}
+	printResult(log, args, func() string { return CreateSubjectTable(subjects) }, subjects)
+	return nil
+}
+
+func subjectInfoConsole(log common.Logger, registry *schemaregistry.Client, args Args) error {
+	if err := requireRegistry(registry, args); err != nil {
+		return err
+	}
+	subject, err := pickSubject(log, registry, args)
+	if err != nil {
+		return err
+	}
+	info, err := registry.SubjectInfo(subject)
+	if err != nil {
+		return fmt.Errorf("could not retrieve subject %s: %w", subject, err)
+	}
+	printResult(log, args, func() string {
+		return fmt.Sprintf("%s\nLatest schema:\n%s", CreateSubjectInfoTable(info), info.Latest.Schema)
+	}, info)
+	return nil
+}
+
+// schemaTypeOf returns the --schema-type or derives the type from the extension of the schema file
+func schemaTypeOf(fileName string, args Args) (string, error) {
+	if args.SchemaType != "" {
+		return strings.ToUpper(args.SchemaType), nil
+	}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".avsc", ".avro":
+		return schemaregistry.Avro, nil
+	case ".proto":
+		return schemaregistry.Protobuf, nil
+	case ".json":
+		return schemaregistry.Json, nil
+	default:
+		return "", usageErrorf("cannot determine the schema type of %s (use --schema-type)", fileName)
+	}
+}
+
+func checkCompatibilityConsole(log common.Logger, registry *schemaregistry.Client, args Args, extraArgs []string) error {
+	if err := requireRegistry(registry, args); err != nil {
+		return err
+	}
+	if len(extraArgs) != 1 {
+		return usageErrorf("usage: checkCompatibility <schema file>")
+	}
+	fileName := extraArgs[0]
+	schemaType, err := schemaTypeOf(fileName, args)
+	if err != nil {
+		return err
+	}
+	schema, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("could not read schema file %s: %w", fileName, err)
+	}
+	subject, err := pickSubject(log, registry, args)
+	if err != nil {
+		return err
+	}
+
+	result, err := registry.CheckCompatibility(subject, schemaregistry.Schema{SchemaType: schemaType, Schema: string(schema)})
+	if err != nil {
+		return fmt.Errorf("could not check compatibility with subject %s: %w", subject, err)
+	}
+	printResult(log, args, func() string { return CreateCompatibilityTable(result) }, result)
+	if !result.Compatible {
+		return fmt.Errorf("schema %s is not compatible with subject %s", fileName, subject)
+	}
+	log.Infof("Schema %s is compatible with subject %s", fileName, subject)
+	return nil
+}
@@ -0,0 +1,216 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	Avro     = "AVRO"
+	Protobuf = "PROTOBUF"
+	Json     = "JSON"
+)
+
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+type Schema struct {
+	Id         int         `json:"id,omitempty"`
+	Subject    string      `json:"subject,omitempty"`
+	Version    int         `json:"version,omitempty"`
+	SchemaType string      `json:"schemaType,omitempty"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references,omitempty"`
+
+	avroCodec *goavro.Codec
+	protoFile protoreflect.FileDescriptor
+}
+
+// failedLookupTTL is how long a failed schema lookup is remembered before the registry is asked again
+const failedLookupTTL = 30 * time.Second
+
+// schemaLookup is a fetch of a schema by id - concurrent callers asking for the same id wait for the same lookup
+type schemaLookup struct {
+	done   chan struct{}
+	schema *Schema
+	err    error
+	// expires is when a failed lookup is retried
+	expires time.Time
+}
+
+// Client talks to a Confluent compatible schema registry - schemas are cached by id since they never change
+type Client struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+	mutex      sync.Mutex
+	schemas    map[int]*Schema
+	// lookups holds the fetches in progress and the failed ones, so that e.g. binary payloads that happen to look
+	// framed do not cause a request (and possibly a timeout) for every message
+	lookups map[int]*schemaLookup
+}
+
+func NewClient(registryUrl string, username string, password string) *Client {
+	return &Client{
+		url:        strings.TrimSuffix(registryUrl, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		schemas:    make(map[int]*Schema),
+		lookups:    make(map[int]*schemaLookup),
+	}
+}
+
+// Error is returned when the registry responds with an error - ErrorCode is the registry specific error code
+type Error struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry error %d: %s", e.ErrorCode, e.Message)
+}
+
+func (c *Client) do(method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		registryErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(respBody, registryErr) != nil || registryErr.Message == "" {
+			registryErr.Message = fmt.Sprintf("%s for %s: %s", resp.Status, path, strings.TrimSpace(string(respBody)))
+		}
+		return registryErr
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+func (c *Client) get(path string, result any) error {
+	return c.do(http.MethodGet, path, nil, result)
+}
+
+// SchemaById returns the schema with the given id, ready to decode payloads with
+func (c *Client) SchemaById(id int) (*Schema, error) {
+	c.mutex.Lock()
+	if schema, ok := c.schemas[id]; ok {
+		c.mutex.Unlock()
+		return schema, nil
+	}
+	lookup, ok := c.lookups[id]
+	if ok {
+		select {
+		case <-lookup.done:
+			if time.Now().Before(lookup.expires) {
+				c.mutex.Unlock()
+				return nil, lookup.err
+			}
+			ok = false
+		default:
+		}
+	}
+	if ok {
+		c.mutex.Unlock()
+		<-lookup.done
+		return lookup.schema, lookup.err
+	}
+	lookup = &schemaLookup{done: make(chan struct{})}
+	c.lookups[id] = lookup
+	c.mutex.Unlock()
+
+	lookup.schema, lookup.err = c.fetchSchema(id)
+
+	c.mutex.Lock()
+	if lookup.err == nil {
+		c.schemas[id] = lookup.schema
+		delete(c.lookups, id)
+	} else {
+		lookup.expires = time.Now().Add(failedLookupTTL)
+	}
+	c.mutex.Unlock()
+	close(lookup.done)
+	return lookup.schema, lookup.err
+}
+
+func (c *Client) fetchSchema(id int) (*Schema, error) {
+	schema := &Schema{}
+	if err := c.get(fmt.Sprintf("/schemas/ids/%d", id), schema); err != nil {
+		return nil, err
+	}
+	schema.Id = id
+	if err := c.compile(schema); err != nil {
+		return nil, fmt.Errorf("cannot parse schema %d: %v", id, err)
+	}
+	return schema, nil
+}
+
+// SchemaBySubject returns a version of the schema registered for the subject (the latest version if version < 1)
+func (c *Client) SchemaBySubject(subject string, version int) (*Schema, error) {
+	v := "latest"
+	if version > 0 {
+		v = fmt.Sprintf("%d", version)
+	}
+	schema := &Schema{}
+	if err := c.get(fmt.Sprintf("/subjects/%s/versions/%s", url.PathEscape(subject), v), schema); err != nil {
+		return nil, err
+	}
+	if schema.SchemaType == "" {
+		schema.SchemaType = Avro
+	}
+	return schema, nil
+}
+
+func (c *Client) compile(schema *Schema) error {
+	var err error
+	switch schema.SchemaType {
+	case "", Avro:
+		schema.SchemaType = Avro
+		schema.avroCodec, err = goavro.NewCodec(schema.Schema)
+	case Protobuf:
+		schema.protoFile, err = c.compileProtobuf(schema)
+	case Json:
+	default:
+		err = fmt.Errorf("unsupported schema type %s", schema.SchemaType)
+	}
+	return err
+}
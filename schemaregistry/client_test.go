@@ -0,0 +1,179 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const orderSchema = `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"},{"name":"amount","type":"long"}]}`
+
+// stubRegistry serves /schemas/ids/<id> from schemas and counts the lookups per id
+type stubRegistry struct {
+	schemas  map[int]Schema
+	username string
+	password string
+	// release, if set, holds the responses until it is closed
+	release chan struct{}
+	mutex   sync.Mutex
+	lookups map[int]int
+}
+
+func newStubRegistry(t *testing.T, stub *stubRegistry) *Client {
+	stub.lookups = map[int]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != stub.username || password != stub.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error_code":401,"message":"Unauthorized"}`)
+			return
+		}
+		var id int
+		if _, err := fmt.Sscanf(r.URL.Path, "/schemas/ids/%d", &id); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		stub.mutex.Lock()
+		stub.lookups[id]++
+		stub.mutex.Unlock()
+		if stub.release != nil {
+			<-stub.release
+		}
+		schema, ok := stub.schemas[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code":40403,"message":"Schema not found"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(schema)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL+"/", stub.username, stub.password)
+}
+
+func (s *stubRegistry) lookupCount(id int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lookups[id]
+}
+
+func frame(id int, payload []byte) []byte {
+	data := []byte{magicByte, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(data[1:], uint32(id))
+	return append(data, payload...)
+}
+
+func TestDecodeAvro(t *testing.T) {
+	stub := &stubRegistry{schemas: map[int]Schema{1: {Schema: orderSchema}}, username: "jokk", password: "secret"}
+	client := newStubRegistry(t, stub)
+
+	codec, err := goavro.NewCodec(orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := codec.BinaryFromNative(nil, map[string]any{"id": "order-1", "amount": int64(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		decoded, err := client.Decode(frame(1, payload))
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		var order map[string]any
+		if err = json.Unmarshal(decoded, &order); err != nil || order["id"] != "order-1" || order["amount"] != float64(42) {
+			t.Fatalf("unexpected decoded order %s (%v)", decoded, err)
+		}
+	}
+	if n := stub.lookupCount(1); n != 1 {
+		t.Errorf("expected the schema to be fetched once, got %d lookups", n)
+	}
+}
+
+func TestDecodeJsonSchema(t *testing.T) {
+	stub := &stubRegistry{schemas: map[int]Schema{7: {SchemaType: Json, Schema: `{"type":"object"}`}}}
+	client := newStubRegistry(t, stub)
+
+	decoded, err := client.Decode(frame(7, []byte(`{"id":"order-1"}`)))
+	if err != nil || string(decoded) != `{"id":"order-1"}` {
+		t.Fatalf("unexpected result %s (%v)", decoded, err)
+	}
+	if _, err = client.Decode(frame(7, []byte("not json"))); err == nil {
+		t.Error("expected an error for a payload that is not JSON")
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	stub := &stubRegistry{schemas: map[int]Schema{1: {Schema: orderSchema}}, username: "jokk", password: "secret"}
+	client := newStubRegistry(t, stub)
+	client.password = "wrong"
+
+	_, err := client.SchemaById(1)
+	var registryErr *Error
+	if !errors.As(err, &registryErr) || registryErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestFailedLookupIsCached(t *testing.T) {
+	stub := &stubRegistry{schemas: map[int]Schema{}}
+	client := newStubRegistry(t, stub)
+
+	for i := 0; i < 5; i++ {
+		_, err := client.Decode(frame(99, []byte("binary payload")))
+		if err == nil || !strings.Contains(err.Error(), "Schema not found") {
+			t.Fatalf("expected schema not found, got %v", err)
+		}
+	}
+	if n := stub.lookupCount(99); n != 1 {
+		t.Errorf("expected one lookup of the unknown id, got %d", n)
+	}
+
+	// once the failure has expired the registry is asked again
+	client.mutex.Lock()
+	client.lookups[99].expires = client.lookups[99].expires.Add(-2 * failedLookupTTL)
+	client.mutex.Unlock()
+	client.SchemaById(99)
+	if n := stub.lookupCount(99); n != 2 {
+		t.Errorf("expected the expired failure to be looked up again, got %d lookups", n)
+	}
+}
+
+func TestConcurrentLookupsAreShared(t *testing.T) {
+	stub := &stubRegistry{schemas: map[int]Schema{1: {Schema: orderSchema}}, release: make(chan struct{})}
+	client := newStubRegistry(t, stub)
+
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if schema, err := client.SchemaById(1); err != nil || schema.SchemaType != Avro {
+				failures.Add(1)
+			}
+		}()
+	}
+	// wait for the first request to reach the registry
+	for stub.lookupCount(1) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stub.release)
+	wg.Wait()
+
+	if failures.Load() > 0 {
+		t.Errorf("%d lookups failed", failures.Load())
+	}
+	if n := stub.lookupCount(1); n != 1 {
+		t.Errorf("expected the concurrent lookups to share one request, got %d", n)
+	}
+}
@@ -0,0 +1,63 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Payloads produced with a schema registry serializer start with a magic byte followed by the 4 byte schema id
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+// IsFramed returns true if the data starts with the schema registry wire format header
+func IsFramed(data []byte) bool {
+	return len(data) >= headerSize && data[0] == magicByte
+}
+
+// SchemaId returns the schema id of framed data
+func SchemaId(data []byte) (int, error) {
+	if !IsFramed(data) {
+		return 0, fmt.Errorf("data is not in the schema registry wire format")
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), nil
+}
+
+// Unframe splits framed data into the schema id and the payload
+func Unframe(data []byte) (int, []byte, error) {
+	id, err := SchemaId(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, data[headerSize:], nil
+}
+
+// Decode converts framed data (Avro, Protobuf or JSON Schema) to JSON
+func (c *Client) Decode(data []byte) ([]byte, error) {
+	id, payload, err := Unframe(data)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := c.SchemaById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch schema.SchemaType {
+	case Avro:
+		native, _, err := schema.avroCodec.NativeFromBinary(payload)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode avro payload with schema %d: %v", id, err)
+		}
+		return schema.avroCodec.TextualFromNative(nil, native)
+	case Protobuf:
+		return decodeProtobuf(schema, payload)
+	default:
+		if !json.Valid(payload) {
+			return nil, fmt.Errorf("payload with schema %d is not valid JSON", id)
+		}
+		return payload, nil
+	}
+}
@@ -0,0 +1,100 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// compileProtobuf parses the .proto schema together with the schemas it references (imports)
+func (c *Client) compileProtobuf(schema *Schema) (protoreflect.FileDescriptor, error) {
+	fileName := fmt.Sprintf("schema-%d.proto", schema.Id)
+	sources := map[string]string{fileName: schema.Schema}
+	if err := c.addReferences(schema.References, sources); err != nil {
+		return nil, err
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), fileName)
+	if err != nil {
+		return nil, err
+	}
+	return files[0], nil
+}
+
+func (c *Client) addReferences(references []Reference, sources map[string]string) error {
+	for _, r := range references {
+		if _, ok := sources[r.Name]; ok {
+			continue
+		}
+		referenced, err := c.SchemaBySubject(r.Subject, r.Version)
+		if err != nil {
+			return fmt.Errorf("cannot fetch referenced schema %s: %v", r.Name, err)
+		}
+		sources[r.Name] = referenced.Schema
+		if err = c.addReferences(referenced.References, sources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * The protobuf wire format has a list of message indexes between the schema id and the message. The indexes point out
+ * what message in the schema was used: the first index is the top level message and the following are nested messages.
+ * The list is written as a count followed by the indexes (all zigzag varints) and a single 0 is short for [0].
+ */
+func MessageIndexes(payload []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(payload)
+	if n <= 0 || count < 0 {
+		return nil, nil, fmt.Errorf("invalid message indexes in protobuf payload")
+	}
+	payload = payload[n:]
+	if count == 0 {
+		return []int{0}, payload, nil
+	}
+
+	indexes := []int{}
+	for i := int64(0); i < count; i++ {
+		index, n := binary.Varint(payload)
+		if n <= 0 || index < 0 {
+			return nil, nil, fmt.Errorf("invalid message indexes in protobuf payload")
+		}
+		indexes = append(indexes, int(index))
+		payload = payload[n:]
+	}
+	return indexes, payload, nil
+}
+
+func decodeProtobuf(schema *Schema, payload []byte) ([]byte, error) {
+	indexes, payload, err := MessageIndexes(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := schema.protoFile.Messages()
+	var descriptor protoreflect.MessageDescriptor
+	for _, index := range indexes {
+		if index >= messages.Len() {
+			return nil, fmt.Errorf("schema %d does not have a message with index %v", schema.Id, indexes)
+		}
+		descriptor = messages.Get(index)
+		messages = descriptor.Messages()
+	}
+
+	msg := dynamicpb.NewMessage(descriptor)
+	if err = proto.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("cannot decode protobuf payload with schema %d: %v", schema.Id, err)
+	}
+	return protojson.Marshal(msg)
+}
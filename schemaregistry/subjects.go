@@ -0,0 +1,120 @@
+package schemaregistry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// Error codes of the schema registry
+const (
+	errSubjectNotFound            = 40401
+	errVersionNotFound            = 40402
+	errCompatibilityNotConfigured = 40408
+)
+
+type SubjectInfo struct {
+	Subject       string
+	Versions      []int
+	Compatibility string
+	Latest        *Schema
+}
+
+type CompatibilityResult struct {
+	Subject    string
+	Compatible bool
+	Messages   []string
+}
+
+func isErrorCode(err error, codes ...int) bool {
+	var registryErr *Error
+	if !errors.As(err, &registryErr) {
+		return false
+	}
+	for _, code := range codes {
+		if registryErr.ErrorCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) Subjects() ([]string, error) {
+	subjects := []string{}
+	if err := c.get("/subjects", &subjects); err != nil {
+		return nil, err
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+func (c *Client) Versions(subject string) ([]int, error) {
+	versions := []int{}
+	if err := c.get(fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject)), &versions); err != nil {
+		return nil, err
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Compatibility returns the compatibility level of the subject, or the global level if the subject does not have its own
+func (c *Client) Compatibility(subject string) (string, error) {
+	config := struct {
+		CompatibilityLevel string `json:"compatibilityLevel"`
+	}{}
+	err := c.get(fmt.Sprintf("/config/%s", url.PathEscape(subject)), &config)
+	if isErrorCode(err, errSubjectNotFound, errCompatibilityNotConfigured) {
+		err = c.get("/config", &config)
+	}
+	return config.CompatibilityLevel, err
+}
+
+func (c *Client) SubjectInfo(subject string) (SubjectInfo, error) {
+	info := SubjectInfo{Subject: subject}
+	var err error
+	if info.Versions, err = c.Versions(subject); err != nil {
+		return info, err
+	}
+	if info.Compatibility, err = c.Compatibility(subject); err != nil {
+		return info, err
+	}
+	info.Latest, err = c.SchemaBySubject(subject, -1)
+	return info, err
+}
+
+// SubjectExists returns false if the registry does not know the subject
+func (c *Client) SubjectExists(subject string) (bool, error) {
+	_, err := c.Versions(subject)
+	if isErrorCode(err, errSubjectNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CheckCompatibility tests the schema against the latest version of the subject using the compatibility level of the subject
+func (c *Client) CheckCompatibility(subject string, schema Schema) (CompatibilityResult, error) {
+	result := CompatibilityResult{Subject: subject}
+	if schema.SchemaType == Avro {
+		// AVRO is the default and some older registries do not accept it as a schema type
+		schema.SchemaType = ""
+	}
+	response := struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}{}
+	err := c.do(http.MethodPost, fmt.Sprintf("/compatibility/subjects/%s/versions/latest?verbose=true", url.PathEscape(subject)), schema, &response)
+	if isErrorCode(err, errSubjectNotFound, errVersionNotFound) {
+		// Any schema is compatible with a subject that does not have any versions yet
+		result.Compatible = true
+		result.Messages = []string{fmt.Sprintf("subject %s does not have any versions yet", subject)}
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Compatible = response.IsCompatible
+	result.Messages = response.Messages
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/henrikengstrom/jokk/common"
+	"github.com/henrikengstrom/jokk/kafka"
+)
+
+func listScramUsersConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	var users []string
+	if args.ScramUser != "" {
+		users = []string{args.ScramUser}
+	}
+	infos, err := kafka.ListScramUsers(admin, users)
+	if err != nil {
+		return fmt.Errorf("could not list SCRAM users: %w", err)
+	}
+	printResult(log, args, func() string { return CreateScramUserTable(infos) }, infos)
+	return nil
+}
+
+// scramUserExists checks if the user already has a credential for the mechanism
+func scramUserExists(admin sarama.ClusterAdmin, user string, mechanism sarama.ScramMechanismType) (bool, error) {
+	infos, err := kafka.ListScramUsers(admin, []string{user})
+	if err != nil {
+		return false, err
+	}
+	for _, info := range infos {
+		if info.Mechanism == mechanism.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func scramUserName(args Args) (string, error) {
+	return valueOrDialogue(args, args.ScramUser, "--scram-user", "enter user name (0 to exit)", "0")
+}
+
+func newScramPassword(args Args) ([]byte, error) {
+	if args.NonInteractive {
+		return nil, usageErrorf("SCRAM passwords can only be entered through a prompt and not in non-interactive mode")
+	}
+	password, err := passwordDialogue("enter password")
+	if err != nil {
+		return nil, fmt.Errorf("could not read password: %w", err)
+	}
+	confirmation, err := passwordDialogue("confirm password")
+	if err != nil {
+		return nil, fmt.Errorf("could not read password: %w", err)
+	}
+	if len(password) == 0 || !bytes.Equal(password, confirmation) {
+		return nil, usageErrorf("passwords are empty or do not match")
+	}
+	return password, nil
+}
+
+// upsertScramUserConsole creates (create == true) or updates the credential of a SCRAM user
+func upsertScramUserConsole(log common.Logger, admin sarama.ClusterAdmin, args Args, create bool) error {
+	mechanism, err := kafka.ScramMechanism(args.ScramMechanism)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	user, err := scramUserName(args)
+	if err != nil {
+		return err
+	}
+	exists, err := scramUserExists(admin, user, mechanism)
+	if err != nil {
+		return fmt.Errorf("could not describe SCRAM user %s: %w", user, err)
+	}
+	if create && exists {
+		return fmt.Errorf("SCRAM user %s already has a %s credential - use updateScramUser to change the password", user, mechanism)
+	}
+	if !create && !exists {
+		return fmt.Errorf("SCRAM user %s does not have a %s credential - use createScramUser to add it", user, mechanism)
+	}
+
+	password, err := newScramPassword(args)
+	if err != nil {
+		return err
+	}
+	if err = kafka.UpsertScramUser(admin, user, mechanism, int32(args.ScramIterations), password); err != nil {
+		return fmt.Errorf("could not save SCRAM user %s: %w", user, err)
+	}
+	if create {
+		log.Infof("SCRAM user %s created (%s)", user, mechanism)
+	} else {
+		log.Infof("SCRAM user %s updated (%s)", user, mechanism)
+	}
+	return nil
+}
+
+func deleteScramUserConsole(log common.Logger, admin sarama.ClusterAdmin, args Args) error {
+	mechanism, err := kafka.ScramMechanism(args.ScramMechanism)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	user, err := scramUserName(args)
+	if err != nil {
+		return err
+	}
+	if err = confirm(args, fmt.Sprintf("delete the %s credential of user %s", mechanism, user)); err != nil {
+		return err
+	}
+	if err = kafka.DeleteScramUser(admin, user, mechanism); err != nil {
+		return fmt.Errorf("could not delete SCRAM user %s: %w", user, err)
+	}
+	log.Infof("SCRAM user %s deleted (%s)", user, mechanism)
+	return nil
+}
@@ -3,11 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 	"github.com/henrikengstrom/jokk/common"
@@ -130,8 +131,7 @@ func listTopicsLoop(envCtrl EnvCtrl, uiCtrl UICtrl) {
 				if topicNumber != "X" {
 					topicName := extractTopicName(topicNumber, rowsContent)
 					if topicName != "" {
-						topicDetails, _, _ := filterTopics(topics, topicName)
-						topicDetail := topicDetails[topicName]
+						topicDetail := topics[topicName]
 						topicInfoLoop(topicName, topicDetail, envCtrl, uiCtrl)
 					}
 				}
@@ -144,7 +144,7 @@ func listTopicsLoop(envCtrl EnvCtrl, uiCtrl UICtrl) {
 
 func topicInfoLoop(topicName string, topicDetail sarama.TopicDetail, envCtrl EnvCtrl, uiCtrl UICtrl) {
 	envCtrl.logger.Clear()
-	topicInfo(envCtrl.logger, topicName, topicDetail, envCtrl.admin, envCtrl.client)
+	topicInfo(envCtrl.logger, topicName, topicDetail, envCtrl.admin, envCtrl.client, envCtrl.args)
 	titleText := fmt.Sprintf("Topic Info - data retrieved %s", time.Now().Format("2006-01-02 15:04:05"))
 	if envCtrl.args.StartTime != "" || envCtrl.args.EndTime != "" {
 		titleText = fmt.Sprintf("%s  - period '%s to %s'", titleText, envCtrl.args.StartTime, envCtrl.args.EndTime)
@@ -189,7 +189,7 @@ func topicInfoLoop(topicName string, topicDetail sarama.TopicDetail, envCtrl Env
 				ui.Render(uiCtrl.commandArea)
 				fileName := keyboardInput(uiCtrl, "X")
 				if fileName != "X" {
-					storeMessages(envCtrl.logger, fileName, topicName, envCtrl.consumer, envCtrl.args)
+					storeMessages(envCtrl.logger, fileName, topicName, envCtrl.client, envCtrl.consumer, envCtrl.decoders, envCtrl.args)
 					uiCtrl.commandArea.Text = fmt.Sprintf("Messages saved to: %s - press enter to continue", fileName)
 					ui.Render(uiCtrl.commandArea)
 					keyboardInput(uiCtrl, "X")
@@ -244,27 +244,49 @@ func topicInfoLoop(topicName string, topicDetail sarama.TopicDetail, envCtrl Env
 
 type MsgInfo struct {
 	timestamp time.Time
+	partition int32
 	offset    int64
+	key       string
+	headers   string
 	value     string
 }
 
+const (
+	messageOrderTime      = "time"
+	messageOrderPartition = "partition"
+)
+
+// sortMessages orders messages by descending time or, with the "partition" order, by partition and offset
+func sortMessages(msgs []MsgInfo, order string) {
+	sort.Slice(msgs, func(i, j int) bool {
+		if order == messageOrderPartition {
+			if msgs[i].partition != msgs[j].partition {
+				return msgs[i].partition < msgs[j].partition
+			}
+			return msgs[i].offset < msgs[j].offset
+		}
+		return msgs[i].timestamp.After(msgs[j].timestamp)
+	})
+}
+
 func viewMessagesLoop(topicName string, topicDetail sarama.TopicDetail, envCtrl EnvCtrl, uiCtrl UICtrl) {
 	resultChan := make(chan sarama.ConsumerMessage)
 	commandChan := make(chan string)
-	go viewMessages(topicName, envCtrl.logger, envCtrl.consumer, envCtrl.args, resultChan, commandChan)
+	go viewMessages(topicName, envCtrl.logger, envCtrl.client, envCtrl.consumer, envCtrl.decoders, envCtrl.args, resultChan, commandChan)
 
 	titleText := fmt.Sprintf("View Messages - topic '%s'", topicName)
 	if envCtrl.args.StartTime != "" || envCtrl.args.EndTime != "" {
 		titleText = fmt.Sprintf("%s  - period '%s to %s'", titleText, envCtrl.args.StartTime, envCtrl.args.EndTime)
 	}
 	uiCtrl.mainArea.Title = titleText
-	commandText := "N:Next Message, Z:Refresh Page, T:Topic Info, L:List Topics, M:Main, Q:Quit"
+	commandText := "N:Next Message, P:Group by Partition/Order by Time, Z:Refresh Page, T:Topic Info, L:List Topics, M:Main, Q:Quit"
 	uiCtrl.commandArea.Text = commandText
 	text := "Retrieving messages..."
 	uiCtrl.mainArea.Text = text
 	ui.Render(uiCtrl.grid)
 
 	msgs := []MsgInfo{}
+	order := envCtrl.args.MessageOrder
 	for {
 		select {
 		case e := <-ui.PollEvents():
@@ -272,6 +294,17 @@ func viewMessagesLoop(topicName string, topicDetail sarama.TopicDetail, envCtrl
 				switch strings.ToUpper(e.ID) {
 				case "N":
 					commandChan <- "Y"
+				case "P":
+					if order == messageOrderPartition {
+						order = messageOrderTime
+					} else {
+						order = messageOrderPartition
+					}
+					if len(msgs) > 0 {
+						text = CreateMessagesTable(msgs, uiCtrl.mainArea.Dx(), order)
+						uiCtrl.mainArea.Text = text
+						ui.Render(uiCtrl.mainArea)
+					}
 				case "T":
 					topicInfoLoop(topicName, topicDetail, envCtrl, uiCtrl)
 				case "L":
@@ -295,14 +328,17 @@ func viewMessagesLoop(topicName string, topicDetail sarama.TopicDetail, envCtrl
 			if msg.Topic != "" {
 				msgs = append(msgs, MsgInfo{
 					timestamp: msg.Timestamp,
+					partition: msg.Partition,
 					offset:    msg.Offset,
+					key:       envCtrl.decoders.keyText(msg),
+					headers:   headersText(msg),
 					value:     string(msg.Value),
 				})
 
 				// FIXME: Only render parts of the messages since the text area can only present a couple.
 				// The logic here could keep track of total number of messages and the ones that are currently being rendered.
 				// E.g. msgs 114-135 is currently viewed. When the user scrolls up or down the messages rendered are changed accordingly.
-				text = CreateMessagesTable(msgs, uiCtrl.mainArea.Dx())
+				text = CreateMessagesTable(msgs, uiCtrl.mainArea.Dx(), order)
 				uiCtrl.mainArea.Text = text
 				ui.Render(uiCtrl.mainArea)
 			} else {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
@@ -9,28 +10,110 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/IBM/sarama"
 	"github.com/henrikengstrom/jokk/common"
+	"golang.org/x/term"
 )
 
-func dialogue(question string, exitAnswer string) string {
+// Exit codes of the console commands
+const (
+	exitError   = 1 // the command failed
+	exitUsage   = 2 // input was missing or invalid, e.g. a prompt was needed in non-interactive mode
+	exitAborted = 3 // the user aborted the command
+)
+
+// errAborted is returned when the user leaves a dialogue or does not confirm an operation
+var errAborted = errors.New("aborted by user - nothing changed")
+
+// usageError is returned when the command cannot run with the given input
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, a ...any) error {
+	return usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+func exitCode(err error) int {
+	if errors.Is(err, errAborted) {
+		return exitAborted
+	}
+	if errors.As(err, &usageError{}) {
+		return exitUsage
+	}
+	return exitError
+}
+
+func dialogue(args Args, question string, exitAnswer string) (string, error) {
+	if args.NonInteractive {
+		return "", usageErrorf("cannot ask '%s' in non-interactive mode", question)
+	}
 	fmt.Printf("%s: ", question)
 	reader := bufio.NewReader(os.Stdin)
 	answer, _ := reader.ReadString('\n')
 	answer = strings.Replace(answer, "\n", "", -1)
 	if strings.ToUpper(answer) == exitAnswer {
-		fmt.Println("leaving topic creation process")
-		os.Exit(0)
+		return "", errAborted
 	}
-	return answer
+	return answer, nil
 }
 
-func filterTopics(topics map[string]sarama.TopicDetail, filter string) (map[string]sarama.TopicDetail, []string, int) {
+// valueOrDialogue returns the value given on the command line or asks for it when running interactively
+func valueOrDialogue(args Args, value string, flag string, question string, exitAnswer string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if args.NonInteractive {
+		return "", usageErrorf("%s is required in non-interactive mode", flag)
+	}
+	return dialogue(args, question, exitAnswer)
+}
+
+// confirm asks the user to confirm a destructive operation unless --yes was given
+func confirm(args Args, question string) error {
+	if args.Yes {
+		return nil
+	}
+	if args.NonInteractive {
+		return usageErrorf("%s: --yes is required to confirm in non-interactive mode", question)
+	}
+	answer, err := dialogue(args, question+"? (Y to confirm, X to exit)", "X")
+	if err != nil {
+		return err
+	}
+	if strings.ToUpper(answer) != "Y" {
+		return errAborted
+	}
+	return nil
+}
+
+// passwordDialogue reads a password without echoing it to the terminal
+func passwordDialogue(question string) ([]byte, error) {
+	fmt.Printf("%s: ", question)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return password, err
+}
+
+// terminalWidth returns the width of the terminal or 160 if it is not known (e.g. when the output is redirected)
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 160
+	}
+	return width
+}
+
+func filterTopics(topics map[string]sarama.TopicDetail, matcher topicMatcher) (map[string]sarama.TopicDetail, []string, int) {
 	// Count topics matching the filter
 	hits := 0
 	filteredTopics := make(map[string]sarama.TopicDetail)
 	for t, td := range topics {
-		if strings.Contains(t, filter) {
+		if matcher.matches(t) {
 			hits += 1
 			filteredTopics[t] = td
 		}
@@ -47,31 +130,83 @@ func filterTopics(topics map[string]sarama.TopicDetail, filter string) (map[stri
 	return filteredTopics, filteredKeys, hits
 }
 
-func pickTopic(log common.Logger, filteredTopics map[string]sarama.TopicDetail, filteredTopicNames []string, hits int, filter string) (string, sarama.TopicDetail) {
-	var topicName string
-	var topicDetail sarama.TopicDetail
+/*
+ * Selects the topic a command works with: the exact --topic name if given, otherwise the topic matching the filter.
+ * If the filter matches more than one topic the user picks one (or the command fails in non-interactive mode).
+ */
+func pickTopic(log common.Logger, admin sarama.ClusterAdmin, args Args) (string, sarama.TopicDetail, error) {
+	topics, err := admin.ListTopics()
+	if err != nil {
+		return "", sarama.TopicDetail{}, fmt.Errorf("could not list topics: %w", err)
+	}
+	if args.Topic != "" {
+		topicDetail, ok := topics[args.Topic]
+		if !ok {
+			return "", topicDetail, fmt.Errorf("topic %s does not exist", args.Topic)
+		}
+		return args.Topic, topicDetail, nil
+	}
+
+	matcher, err := newTopicMatcher(args)
+	if err != nil {
+		return "", sarama.TopicDetail{}, usageErrorf("%v", err)
+	}
+	filteredTopics, filteredTopicNames, _ := filterTopics(topics, matcher)
+	topicName, err := pickName(log, args, filteredTopicNames, "topic")
+	if err != nil {
+		return "", sarama.TopicDetail{}, err
+	}
+	return topicName, filteredTopics[topicName], nil
+}
+
+// pickName returns the only name in the list or lets the user pick one if there is more than one name
+func pickName(log common.Logger, args Args, names []string, kind string) (string, error) {
+	hits := len(names)
 	if hits == 0 {
-		log.Infof("could not find any topics matching the filter: %s", filter)
+		return "", fmt.Errorf("could not find any %ss matching the filter: %s", kind, args.Filter)
 	} else if hits == 1 {
-		topicName = filteredTopicNames[0]
-		topicDetail = filteredTopics[topicName]
-	} else if hits > 1 {
-		log.Infof("found more than one topic [%d] matching the filter: %s", hits, filter)
-		for c, t := range filteredTopicNames {
-			log.Infof("%d: %s", c+1, t)
-		}
-		answer := dialogue("pick a number (0 to exit)", "0")
-		intAnswer, err := strconv.Atoi(answer)
-		if err != nil || intAnswer < 1 || intAnswer > hits {
-			log.Infof("Invalid number: %s - exiting", answer)
-			os.Exit(0)
-		}
+		return names[0], nil
+	}
 
-		topicName = filteredTopicNames[intAnswer-1]
-		topicDetail = filteredTopics[topicName]
+	if args.NonInteractive {
+		return "", usageErrorf("found more than one %s [%d] matching the filter: %s - use --%s to pick one", kind, hits, args.Filter, kind)
+	}
+	log.Infof("found more than one %s [%d] matching the filter: %s", kind, hits, args.Filter)
+	for c, n := range names {
+		log.Infof("%d: %s", c+1, n)
+	}
+	answer, err := dialogue(args, "pick a number (0 to exit)", "0")
+	if err != nil {
+		return "", err
 	}
+	intAnswer, err := strconv.Atoi(answer)
+	if err != nil || intAnswer < 1 || intAnswer > hits {
+		return "", usageErrorf("invalid number: %s", answer)
+	}
+	return names[intAnswer-1], nil
+}
 
-	return topicName, topicDetail
+// matchingTopics returns the topic given with --topic or all topics matching the filter
+func matchingTopics(admin sarama.ClusterAdmin, args Args) ([]string, error) {
+	topics, err := admin.ListTopics()
+	if err != nil {
+		return nil, fmt.Errorf("could not list topics: %w", err)
+	}
+	if args.Topic != "" {
+		if _, ok := topics[args.Topic]; !ok {
+			return nil, fmt.Errorf("topic %s does not exist", args.Topic)
+		}
+		return []string{args.Topic}, nil
+	}
+	matcher, err := newTopicMatcher(args)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	_, filteredTopicNames, hits := filterTopics(topics, matcher)
+	if hits == 0 {
+		return nil, fmt.Errorf("could not find any topics matching the filter: %s", args.Filter)
+	}
+	return filteredTopicNames, nil
 }
 
 func parseTime(log common.Logger, startArg string, endArg string) (time.Time, time.Time, error) {
@@ -143,3 +278,33 @@ func extractTopicName(topicNumber string, rowsContent []string) string {
 
 	return topicName
 }
+
+// parseHeaderFilters converts 'name=value' arguments into a map of header names and expected values
+func parseHeaderFilters(filters []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, f := range filters {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid header filter '%s' - expected format 'name=value'", f)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// matchesHeaderFilters returns true if the message contains every header in the filter with the expected value
+func matchesHeaderFilters(msg sarama.ConsumerMessage, headerFilters map[string]string) bool {
+	for name, value := range headerFilters {
+		found := false
+		for _, h := range msg.Headers {
+			if h != nil && string(h.Key) == name && string(h.Value) == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}